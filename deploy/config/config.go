@@ -20,6 +20,7 @@ import (
 	"helm-ci/deploy/utils"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -27,26 +28,64 @@ import (
 type Config struct {
 	AppName               string
 	Chart                 string
+	ClusterScopedKinds    []string
+	CRDSchemaLocations    []string
+	Command               string
 	Custom                bool
 	CustomNameSpace       string
 	CustomNameSpaceStaged bool
 	DEBUG                 bool
+	DiffIgnore            []string
+	DiffIgnoreDefaults    bool
+	DiscoverClusterScoped bool
 	Domains               []string
 	DomainTemplate        string
 	Environment           string
+	FieldManager          string
+	ForceConflicts        []string
+	Generators            string
 	GitHubOwner           string
 	GitHubRepo            string
 	GitHubToken           string
+	GitSHA                string
+	Images                []string
 	IngressHosts          []string
+	KubeVersion           string
+	LockFile              string
+	ManifestExclude       []string
+	ManifestInclude       []string
 	Namespace             string
 	PRDeployments         bool
+	Plan                  bool
 	PRNumber              string
+	PromoteFrom           string
+	ProtectedStages       []string
+	Prune                 bool
+	PruneDryRun           bool
 	ReleaseName           string
+	RenderTemplates       bool
+	RepoCAFile            string
+	RepoPassword          string
+	RepoToken             string
+	RepoUsername          string
 	Repository            string
 	RootCA                string
+	RunURL                string
+	SchemaLocations       []string
+	SchemaURL             string
+	ServerSide            bool
+	Set                   []string
+	SetFile               []string
+	SetString             []string
 	Stage                 string
+	StandardMetadata      bool
+	StrictDuplicates      bool
 	TraefikDashboard      bool
+	ValidateManifests     bool
+	ValidateValues        bool
+	ValuesLayers          []string
 	ValuesPath            string
+	ValuesSchema          string
 	VaultBasePath         string
 	VaultInsecureTLS      bool
 	VaultToken            string
@@ -55,26 +94,86 @@ type Config struct {
 	VaultKVVersion        int
 }
 
+// DefaultValuesLayers is the default values layering chain, from lowest to highest precedence
+const DefaultValuesLayers = "common,{env}/common,{stage},{env}/{stage},pr"
+
+// sensitiveFields are never printed by PrintConfig
+var sensitiveFields = map[string]bool{
+	"GitHubToken":  true,
+	"RepoPassword": true,
+	"RepoToken":    true,
+	"VaultToken":   true,
+}
+
+// Commands lists the supported sub-commands; without one a normal deployment runs
+var Commands = []string{"explain", "promote"}
+
+// PostRenderCommand runs helm-ci as a Helm post-renderer. It is invoked by helm
+// itself with its own flags, so main handles it before ParseFlags.
+const PostRenderCommand = "post-render"
+
 // ParseFlags parses command line flags and returns a Config
+// An optional sub-command may precede the flags, e.g. "deploy promote --stage=live ..."
 func ParseFlags() *Config {
 	cfg := &Config{}
 
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cfg.Command = args[0]
+		args = args[1:]
+		if !slices.Contains(Commands, cfg.Command) {
+			utils.NewError("unknown command %q, available commands: %v", cfg.Command, Commands)
+			os.Exit(1)
+		}
+	}
+
 	flag.StringVar(&cfg.Stage, "stage", "", "Deployment stage (dev/live)")
 	flag.StringVar(&cfg.AppName, "app", "", "Application name")
 	flag.StringVar(&cfg.Environment, "env", "", "Environment")
 	flag.StringVar(&cfg.PRNumber, "pr", "", "PR number")
 	flag.StringVar(&cfg.ValuesPath, "values", "helm/values", "Path to values files")
-	flag.StringVar(&cfg.Chart, "chart", "", "Helm chart (optional)")
-	flag.StringVar(&cfg.Version, "version", "", "Chart version (optional)")
+	flag.BoolVar(&cfg.ValidateValues, "validate-values", true, "Validate the merged values against the chart's values.schema.json and --values-schema")
+	flag.StringVar(&cfg.ValuesSchema, "values-schema", "", "JSON Schema for the values (defaults to values.schema.json in the values path, if present)")
+	valuesLayersStr := flag.String("values-layers", DefaultValuesLayers, "Comma-separated values layers below the values path, lowest precedence first; {env} and {stage} are substituted")
+	flag.StringVar(&cfg.Chart, "chart", "", "Helm chart name or local chart path (optional)")
+	flag.StringVar(&cfg.Version, "version", "", "Chart version or constraint, e.g. ~1.4, \">=2.0 <3\" or latest-stable (optional)")
 	flag.StringVar(&cfg.Repository, "repo", "", "Helm repository (optional)")
+	flag.StringVar(&cfg.RepoUsername, "repo-username", os.Getenv("HELM_REPO_USERNAME"), "Helm repository/registry username (optional)")
+	flag.StringVar(&cfg.RepoPassword, "repo-password", os.Getenv("HELM_REPO_PASSWORD"), "Helm repository/registry password (optional)")
+	flag.StringVar(&cfg.RepoToken, "repo-token", os.Getenv("HELM_REPO_TOKEN"), "Helm repository/registry bearer token (optional)")
+	flag.StringVar(&cfg.RepoCAFile, "repo-ca-file", "", "CA bundle to verify the Helm repository/registry (optional)")
 	flag.StringVar(&cfg.GitHubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "GitHub API token")
 	flag.StringVar(&cfg.GitHubRepo, "github-repo", "", "GitHub repository name")
 	flag.StringVar(&cfg.GitHubOwner, "github-owner", "", "GitHub repository owner")
+	flag.StringVar(&cfg.GitSHA, "git-sha", os.Getenv("GITHUB_SHA"), "Git commit of the deployed values (defaults to GITHUB_SHA)")
+	flag.StringVar(&cfg.RunURL, "run-url", githubRunURL(), "URL of the workflow run recorded on deployed resources (defaults to the GitHub Actions run)")
+	flag.BoolVar(&cfg.StandardMetadata, "standard-metadata", true, "Label and annotate every deployed resource with stage, PR, git SHA, run URL and deploy time")
+	flag.StringVar(&cfg.LockFile, "lockfile", "", "Chart lockfile recording the deployed chart per app and stage (optional)")
+	flag.StringVar(&cfg.PromoteFrom, "from", "dev", "Stage to promote from (promote command)")
 	domainsStr := flag.String("domains", "", "Comma-separated list of domains")
 	flag.StringVar(&cfg.DomainTemplate, "domain-template", "default", "Domain template to use")
 	flag.StringVar(&cfg.CustomNameSpace, "custom-namespace", "", "Custom K8s Namespace")
 	flag.BoolVar(&cfg.CustomNameSpaceStaged, "custom-namespace-staged", false, "Custom K8s Namespace")
 	flag.BoolVar(&cfg.Custom, "custom", false, "Custom Kubernetes deployment")
+	flag.Var((*stringSlice)(&cfg.ClusterScopedKinds), "cluster-scoped-kind", "Additional cluster-scoped kind whose namespace is never set in custom deployments (repeatable)")
+	flag.BoolVar(&cfg.ServerSide, "server-side", false, "Use server-side apply in custom deployments")
+	flag.StringVar(&cfg.FieldManager, "field-manager", "helm-ci", "Field manager name for server-side apply")
+	forceConflictsStr := flag.String("force-conflicts", "", "Comma-separated stages in which server-side apply takes ownership of conflicting fields")
+	flag.BoolVar(&cfg.Prune, "prune", false, "Delete resources removed from the manifests in custom deployments, tracked by an inventory ConfigMap")
+	flag.BoolVar(&cfg.PruneDryRun, "prune-dry-run", false, "Only report the resources pruning would delete")
+	flag.StringVar(&cfg.KubeVersion, "kube-version", "", "Target Kubernetes version, e.g. 1.29.0, for manifest schema validation and deprecated API detection")
+	flag.BoolVar(&cfg.Plan, "plan", false, "Show the diff and checks without deploying")
+	protectedStagesStr := flag.String("protected-stages", "live", "Comma-separated stages whose deployment fails on deprecated APIs")
+	flag.BoolVar(&cfg.ValidateManifests, "validate-manifests", true, "Validate custom manifests against the Kubernetes schemas of --kube-version before applying them")
+	flag.Var((*stringSlice)(&cfg.SchemaLocations), "schema-location", "Directory with Kubernetes JSON schemas in the kubeconform layout (repeatable, defaults to the user cache)")
+	flag.StringVar(&cfg.SchemaURL, "schema-url", "https://raw.githubusercontent.com/yannh/kubernetes-json-schema/master", "Base URL to download Kubernetes schemas missing from the user cache from (empty to validate offline only)")
+	flag.Var((*stringSlice)(&cfg.CRDSchemaLocations), "crd-schema-location", "Directory with CRD JSON schemas as <group>/<kind>_<version>.json (repeatable)")
+	flag.StringVar(&cfg.Generators, "generators", "", "ConfigMap and Secret generators of custom deployments (defaults to generators.yaml in the values path, if present)")
+	flag.Var((*stringSlice)(&cfg.Images), "image", "Image override name=registry/app:tag or name@digest for the containers of custom manifests (repeatable)")
+	flag.Var((*stringSlice)(&cfg.ManifestInclude), "manifest-include", "Glob pattern of the files discovered as manifests in custom deployments, default *.y*ml (repeatable)")
+	flag.Var((*stringSlice)(&cfg.ManifestExclude), "manifest-exclude", "Glob pattern of files skipped by manifest discovery, *.example.yaml is always skipped (repeatable)")
+	flag.BoolVar(&cfg.StrictDuplicates, "strict-duplicates", false, "Fail when a resource is defined more than once in custom deployments instead of letting the stage override common")
+	flag.BoolVar(&cfg.DiscoverClusterScoped, "discover-cluster-scoped", false, "Discover cluster-scoped kinds with kubectl api-resources in custom deployments")
 	flag.BoolVar(&cfg.TraefikDashboard, "traefik-dashboard", false, "Deploy Traefik dashboard")
 	flag.StringVar(&cfg.RootCA, "root-ca", "", "Path to root CA certificate")
 	flag.BoolVar(&cfg.PRDeployments, "pr-deployments", true, "Enable PR deployments")
@@ -83,8 +182,14 @@ func ParseFlags() *Config {
 	flag.StringVar(&cfg.VaultBasePath, "vault-base-path", "", "Base path for Vault secrets")
 	flag.BoolVar(&cfg.VaultInsecureTLS, "vault-insecure-tls", false, "Allow insecure TLS connections to Vault (not recommended for production)")
 	flag.IntVar(&cfg.VaultKVVersion, "vault-kv-version", 2, "Vault KV version (1 or 2)")
+	flag.BoolVar(&cfg.RenderTemplates, "render-templates", false, "Render values files and manifests as Go templates before Vault processing")
+	flag.Var((*stringSlice)(&cfg.Set), "set", "Set a chart value key=value, may contain Vault placeholders (repeatable)")
+	flag.Var((*stringSlice)(&cfg.SetString), "set-string", "Set a chart value key=value as string, may contain Vault placeholders (repeatable)")
+	flag.Var((*stringSlice)(&cfg.SetFile), "set-file", "Set a chart value key=path from a file, may contain Vault placeholders (repeatable)")
+	flag.Var((*stringSlice)(&cfg.DiffIgnore), "diff-ignore", "Diff ignore rule [Kind:]path, e.g. Deployment:spec.replicas (repeatable)")
+	flag.BoolVar(&cfg.DiffIgnoreDefaults, "diff-ignore-defaults", true, "Apply the built-in diff ignore rules (Helm labels, checksum annotations, status)")
 	flag.BoolVar(&cfg.DEBUG, "debug", false, "DEBUG output; THIS MAY OUTPUT SECRETS!!!")
-	flag.Parse()
+	flag.CommandLine.Parse(args)
 
 	// Validate required flags
 	if cfg.AppName == "" {
@@ -110,6 +215,24 @@ func ParseFlags() *Config {
 		}
 	}
 
+	for _, stage := range strings.Split(*forceConflictsStr, ",") {
+		if stage = strings.TrimSpace(stage); stage != "" {
+			cfg.ForceConflicts = append(cfg.ForceConflicts, stage)
+		}
+	}
+
+	for _, stage := range strings.Split(*protectedStagesStr, ",") {
+		if stage = strings.TrimSpace(stage); stage != "" {
+			cfg.ProtectedStages = append(cfg.ProtectedStages, stage)
+		}
+	}
+
+	for _, layer := range strings.Split(*valuesLayersStr, ",") {
+		if layer = strings.TrimSpace(layer); layer != "" {
+			cfg.ValuesLayers = append(cfg.ValuesLayers, layer)
+		}
+	}
+
 	return cfg
 }
 
@@ -123,7 +246,7 @@ func (c *Config) PrintConfig() {
 		field := v.Field(i)
 		fieldName := t.Field(i).Name
 		// Don't print sensitive values
-		if fieldName == "VaultToken" || fieldName == "GitHubToken" {
+		if sensitiveFields[fieldName] {
 			utils.Log.Info(fmt.Sprintf("%s: [REDACTED]", fieldName))
 		} else {
 			utils.Log.Info(fmt.Sprintf("%s: %v", fieldName, field.Interface()))
@@ -163,3 +286,24 @@ func (c *Config) SetupNames() {
 		}
 	}
 }
+
+// githubRunURL returns the URL of the current GitHub Actions run, or "" outside of Actions
+func githubRunURL() string {
+	server, repo, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || run == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, run)
+}
+
+// stringSlice is a flag.Value that collects every occurrence of a repeatable flag
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
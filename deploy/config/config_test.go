@@ -34,6 +34,9 @@ func TestPrintConfig_SensitiveFields(t *testing.T) {
 		VaultToken:      "vault-secret-token",
 		VaultURL:        "https://vault.example.com",
 		CustomNameSpace: "custom-namespace",
+		RepoUsername:    "repo-user",
+		RepoPassword:    "repo-secret-password",
+		RepoToken:       "repo-secret-token",
 	}
 
 	// Capture log output
@@ -56,6 +59,9 @@ func TestPrintConfig_SensitiveFields(t *testing.T) {
 	if strings.Contains(output, "vault-secret-token") {
 		t.Error("VaultToken was not redacted in the output")
 	}
+	if strings.Contains(output, "repo-secret-password") || strings.Contains(output, "repo-secret-token") {
+		t.Error("Helm repository credentials were not redacted in the output")
+	}
 
 	// Check that [REDACTED] appears for sensitive fields
 	if !strings.Contains(output, "GitHubToken: [REDACTED]") {
@@ -234,7 +240,7 @@ func TestParseFlags_DefaultValues(t *testing.T) {
 	}()
 
 	// Clear environment variables before testing defaults
-	for _, env := range []string{"GITHUB_TOKEN", "VAULT_TOKEN"} {
+	for _, env := range []string{"GITHUB_TOKEN", "GITHUB_SHA", "VAULT_TOKEN", "HELM_REPO_USERNAME", "HELM_REPO_PASSWORD", "HELM_REPO_TOKEN", "GITHUB_RUN_ID"} {
 		os.Unsetenv(env)
 	}
 
@@ -272,6 +278,44 @@ func TestParseFlags_DefaultValues(t *testing.T) {
 		{"VaultInsecureTLS", false},
 		{"DEBUG", false},
 		{"DomainTemplate", "default"},
+		{"DiffIgnore", []string(nil)},
+		{"DiffIgnoreDefaults", true},
+		{"RepoUsername", ""},
+		{"RepoPassword", ""},
+		{"RepoToken", ""},
+		{"RepoCAFile", ""},
+		{"Command", ""},
+		{"GitSHA", ""},
+		{"LockFile", ""},
+		{"PromoteFrom", "dev"},
+		{"RenderTemplates", false},
+		{"Set", []string(nil)},
+		{"SetString", []string(nil)},
+		{"SetFile", []string(nil)},
+		{"ValidateValues", true},
+		{"ValuesSchema", ""},
+		{"RunURL", ""},
+		{"StandardMetadata", true},
+		{"ClusterScopedKinds", []string(nil)},
+		{"DiscoverClusterScoped", false},
+		{"Prune", false},
+		{"PruneDryRun", false},
+		{"ServerSide", false},
+		{"FieldManager", "helm-ci"},
+		{"ForceConflicts", []string(nil)},
+		{"StrictDuplicates", false},
+		{"ManifestInclude", []string(nil)},
+		{"ManifestExclude", []string(nil)},
+		{"Images", []string(nil)},
+		{"Generators", ""},
+		{"KubeVersion", ""},
+		{"ValidateManifests", true},
+		{"SchemaLocations", []string(nil)},
+		{"SchemaURL", "https://raw.githubusercontent.com/yannh/kubernetes-json-schema/master"},
+		{"CRDSchemaLocations", []string(nil)},
+		{"Plan", false},
+		{"ProtectedStages", []string{"live"}},
+		{"ValuesLayers", []string{"common", "{env}/common", "{stage}", "{env}/{stage}", "pr"}},
 	}
 
 	for _, check := range defaultChecks {
@@ -0,0 +1,205 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"os"
+	"sort"
+)
+
+// InstallOrder is the order in which resources are applied, modelled on Helm's
+// install order with CRDs moved up so custom resources can follow them.
+// Kinds not listed are applied last, in the order they were found.
+var InstallOrder = []string{
+	"PriorityClass",
+	"Namespace",
+	"CustomResourceDefinition",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"ServiceAccount",
+	"Secret",
+	"SecretList",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ClusterRole",
+	"ClusterRoleList",
+	"ClusterRoleBinding",
+	"ClusterRoleBindingList",
+	"Role",
+	"RoleList",
+	"RoleBinding",
+	"RoleBindingList",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+// crdEstablishTimeout bounds the wait for applied CRDs to become Established
+const crdEstablishTimeout = "120s"
+
+// applyPhase is a set of resources applied together
+type applyPhase struct {
+	file string
+	// crds are the names of the CustomResourceDefinitions in the phase
+	crds []string
+}
+
+// readManifest reads the documents of a manifest file
+// Empty documents are dropped; invalid ones are kept for kubectl to report.
+func readManifest(file string) ([]*manifest.Document, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, utils.NewError("failed to read manifest file %s: %v", file, err)
+	}
+	var docs []*manifest.Document
+	for _, doc := range manifest.Read(content) {
+		if doc.Node != nil || doc.Err != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// sortManifests sorts documents by InstallOrder, keeping the order of documents of the same rank
+func sortManifests(docs []*manifest.Document) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return installRank(docs[i].Kind()) < installRank(docs[j].Kind())
+	})
+}
+
+// installRank returns the position of a kind in InstallOrder, unknown kinds rank last
+func installRank(kind string) int {
+	for i, k := range InstallOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(InstallOrder)
+}
+
+// applyPhases splits ordered documents into the resources up to and including
+// the CRDs and everything after, so custom resources are applied once their
+// CRDs are Established. Each phase is written to a temporary manifest file.
+func applyPhases(docs []*manifest.Document) ([]applyPhase, error) {
+	var crds []string
+	split := 0
+	for i, doc := range docs {
+		if doc.Kind() == "CustomResourceDefinition" {
+			crds = append(crds, resourceName(doc))
+			split = i + 1
+		}
+	}
+
+	groups := [][]*manifest.Document{docs}
+	if len(crds) > 0 && split < len(docs) {
+		groups = [][]*manifest.Document{docs[:split], docs[split:]}
+	}
+
+	var phases []applyPhase
+	for i, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		file, err := writeManifestFile(group)
+		if err != nil {
+			for _, phase := range phases {
+				os.Remove(phase.file)
+			}
+			return nil, err
+		}
+		phase := applyPhase{file: file}
+		if i == 0 {
+			phase.crds = crds
+		}
+		phases = append(phases, phase)
+	}
+	return phases, nil
+}
+
+// writeManifestFile writes documents to a temporary manifest file
+func writeManifestFile(docs []*manifest.Document) (string, error) {
+	content, err := manifest.Write(docs)
+	if err != nil {
+		return "", utils.NewError("failed to encode manifests: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "manifest-*.yml")
+	if err != nil {
+		return "", utils.NewError("failed to create temporary file: %v", err)
+	}
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to write manifest: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to close temporary file: %v", err)
+	}
+	return tmpFile.Name(), nil
+}
+
+// resourceName returns metadata.name of the resource in a document
+func resourceName(doc *manifest.Document) string {
+	root := doc.Root()
+	if root == nil {
+		return ""
+	}
+	metadata := findChildByKey(root, "metadata")
+	if metadata == nil {
+		return ""
+	}
+	if name := findChildByKey(metadata, "name"); name != nil {
+		return name.Value
+	}
+	return ""
+}
+
+// waitForCRDs waits until the CRDs are Established and serve their custom resources
+func (d *CustomDeployer) waitForCRDs(crds []string) error {
+	if len(crds) == 0 {
+		return nil
+	}
+	utils.Green("Waiting for %d CRD(s) to be established...", len(crds))
+
+	args := []string{"wait", "--for=condition=Established", "--timeout=" + crdEstablishTimeout}
+	for _, crd := range crds {
+		args = append(args, "customresourcedefinition/"+crd)
+	}
+	cmd := d.Cmd.Command("kubectl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := d.Cmd.Run(cmd); err != nil {
+		return utils.NewError("CRDs did not become established: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func writeManifests(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestSortManifests(t *testing.T) {
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		"app.yaml": "kind: Ingress\nmetadata:\n  name: web\n---\nkind: Deployment\nmetadata:\n  name: web\n---\nkind: Certificate\nmetadata:\n  name: web\n",
+		"base.yaml": "kind: ConfigMap\nmetadata:\n  name: settings\n---\n---\nkind: CustomResourceDefinition\nmetadata:\n  name: certificates.cert-manager.io\n" +
+			"---\nkind: ServiceAccount\nmetadata:\n  name: web\n---\nkind: Namespace\nmetadata:\n  name: web\n",
+	})
+
+	var docs []*manifest.Document
+	for _, file := range []string{"app.yaml", "base.yaml"} {
+		fileDocs, err := readManifest(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		docs = append(docs, fileDocs...)
+	}
+	sortManifests(docs)
+
+	var kinds []string
+	for _, doc := range docs {
+		kinds = append(kinds, doc.Kind())
+	}
+	expected := []string{"Namespace", "CustomResourceDefinition", "ServiceAccount", "ConfigMap", "Deployment", "Ingress", "Certificate"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected order %v, got %v", expected, kinds)
+	}
+
+	phases, err := applyPhases(docs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		for _, phase := range phases {
+			os.Remove(phase.file)
+		}
+	}()
+	if len(phases) != 2 {
+		t.Fatalf("Expected a CRD phase and a resource phase, got %d phases", len(phases))
+	}
+	if !reflect.DeepEqual(phases[0].crds, []string{"certificates.cert-manager.io"}) || phases[1].crds != nil {
+		t.Errorf("Expected the CRD to be waited for after the first phase, got %+v", phases)
+	}
+	content, err := os.ReadFile(phases[1].file)
+	if err != nil {
+		t.Fatalf("Failed to read phase manifest: %v", err)
+	}
+	if len(manifest.Read(content)) != 5 {
+		t.Errorf("Expected 5 resources in the second phase, got:\n%s", content)
+	}
+}
+
+func TestCustomDeployer_Deploy_WaitsForCRDs(t *testing.T) {
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		"live/certificate.yaml": "apiVersion: cert-manager.io/v1\nkind: Certificate\nmetadata:\n  name: web\n",
+		"common/crd.yaml":       "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: certificates.cert-manager.io\n",
+	})
+
+	mockCmd := NewMockCommander()
+	deployer := &CustomDeployer{Common: Common{
+		Config: &config.Config{ValuesPath: dir, Stage: "live", Namespace: "web"},
+		Cmd:    mockCmd,
+	}}
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+
+	var steps []string
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "kubectl" && (cmd.Args[0] == "apply" || cmd.Args[0] == "wait") && !slices.Contains(cmd.Args, "--dry-run=server") {
+			steps = append(steps, cmd.Args[0])
+			if cmd.Args[0] == "wait" && cmd.Args[len(cmd.Args)-1] != "customresourcedefinition/certificates.cert-manager.io" {
+				t.Errorf("Expected to wait for the CRD, got %v", cmd.Args)
+			}
+		}
+	}
+	if !reflect.DeepEqual(steps, []string{"apply", "wait", "apply"}) {
+		t.Errorf("Expected apply, wait, apply, got %v", steps)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"helm-ci/deploy/utils"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsLocalChart reports whether the chart refers to a chart directory or packaged chart on disk
+func IsLocalChart(chart string) bool {
+	if chart == "" {
+		return false
+	}
+	if strings.HasPrefix(chart, "./") || strings.HasPrefix(chart, "../") || filepath.IsAbs(chart) {
+		return true
+	}
+	if strings.HasSuffix(chart, ".tgz") {
+		if _, err := os.Stat(chart); err == nil {
+			return true
+		}
+	}
+	if _, err := os.Stat(filepath.Join(chart, "Chart.yaml")); err == nil {
+		return true
+	}
+	return false
+}
+
+// chartReference returns the chart argument for helm upgrade together with any
+// extra flags it needs, and prepares the chart source: dependencies are built
+// for local charts, OCI registries are logged into and HTTP repositories are added
+func (d *HelmDeployer) chartReference() (string, []string, error) {
+	if IsLocalChart(d.Config.Chart) {
+		utils.Log.Infof("Using local chart: %s", d.Config.Chart)
+		if err := d.buildChartDependencies(d.Config.Chart); err != nil {
+			return "", nil, err
+		}
+		return d.Config.Chart, nil, nil
+	}
+
+	creds, err := d.repoCredentials()
+	if err != nil {
+		return "", nil, err
+	}
+	d.repoCreds = creds
+
+	// Check if the repository is an OCI registry
+	if strings.HasPrefix(d.Config.Repository, "oci://") {
+		var extraArgs []string
+		if creds != nil {
+			registryArgs, err := d.registryLogin(creds)
+			if err != nil {
+				return "", nil, err
+			}
+			extraArgs = append(extraArgs, registryArgs...)
+		}
+		if d.Config.RepoCAFile != "" {
+			extraArgs = append(extraArgs, "--ca-file", d.Config.RepoCAFile)
+		}
+		return fmt.Sprintf("%s/%s", d.Config.Repository, d.Config.Chart), extraArgs, nil
+	}
+
+	name := RepoName(d.Config.Repository)
+	utils.Log.Infof("Using Helm repository %s as %s", d.Config.Repository, name)
+
+	repoAddArgs := append([]string{"repo", "add", name, d.Config.Repository}, d.repoConfigArgs()...)
+	if d.Config.RepoCAFile != "" {
+		repoAddArgs = append(repoAddArgs, "--ca-file", d.Config.RepoCAFile)
+	}
+	if creds != nil {
+		repoAddArgs = append(repoAddArgs, "--username", creds.username, "--password-stdin")
+	}
+	repoAddCmd := d.Cmd.Command("helm", repoAddArgs...)
+	if creds != nil {
+		repoAddCmd.Stdin = strings.NewReader(creds.password)
+	}
+	if err := d.Cmd.Run(repoAddCmd); err != nil {
+		return "", nil, utils.NewError("failed to add Helm repository: %v", err)
+	}
+
+	// Only refresh the repository this deployment needs
+	repoUpdateArgs := append([]string{"repo", "update", name}, d.repoConfigArgs()...)
+	repoUpdateCmd := d.Cmd.Command("helm", repoUpdateArgs...)
+	if err := d.Cmd.Run(repoUpdateCmd); err != nil {
+		return "", nil, utils.NewError("failed to update Helm repository: %v", err)
+	}
+
+	return fmt.Sprintf("%s/%s", name, d.Config.Chart), nil, nil
+}
+
+// RepoName derives the repository name from its URL, so apps sharing a name
+// but using different repositories never collide
+func RepoName(repoURL string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(repoURL, "/")))
+	return "helm-ci-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// setupRepoConfig creates the private repositories file and cache used for this run
+// The returned function removes them again
+func (d *HelmDeployer) setupRepoConfig() (func(), error) {
+	dir, err := os.MkdirTemp("", "helm-ci-repos-*")
+	if err != nil {
+		return nil, utils.NewError("failed to create Helm repository config directory: %v", err)
+	}
+	d.repoConfigDir = dir
+	return func() {
+		os.RemoveAll(dir)
+		d.repoConfigDir = ""
+	}, nil
+}
+
+// repoConfigArgs returns the helm flags pointing at the private repository config
+func (d *HelmDeployer) repoConfigArgs() []string {
+	if d.repoConfigDir == "" {
+		return nil
+	}
+	return []string{
+		"--repository-config", filepath.Join(d.repoConfigDir, "repositories.yaml"),
+		"--repository-cache", filepath.Join(d.repoConfigDir, "cache"),
+	}
+}
+
+// buildChartDependencies runs helm dependency build for a chart directory that
+// declares dependencies or ships a Chart.lock
+func (d *HelmDeployer) buildChartDependencies(chartDir string) error {
+	info, err := os.Stat(chartDir)
+	if err != nil {
+		return utils.NewError("failed to read local chart %s: %v", chartDir, err)
+	}
+	if !info.IsDir() {
+		// Packaged charts already contain their dependencies
+		return nil
+	}
+
+	hasDependencies, err := chartHasDependencies(chartDir)
+	if err != nil {
+		return err
+	}
+	if !hasDependencies {
+		return nil
+	}
+
+	utils.Log.Infof("Building chart dependencies for %s", chartDir)
+	depArgs := append([]string{"dependency", "build", chartDir}, d.repoConfigArgs()...)
+	cmd := d.Cmd.Command("helm", depArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := d.Cmd.Run(cmd); err != nil {
+		return utils.NewError("failed to build chart dependencies for %s: %v", chartDir, err)
+	}
+	return nil
+}
+
+// chartHasDependencies checks for a Chart.lock or dependencies declared in Chart.yaml
+func chartHasDependencies(chartDir string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(chartDir, "Chart.lock")); err == nil {
+		return true, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		return false, utils.NewError("failed to read Chart.yaml in %s: %v", chartDir, err)
+	}
+
+	var chart struct {
+		Dependencies []interface{} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal(content, &chart); err != nil {
+		return false, utils.NewError("failed to parse Chart.yaml in %s: %v", chartDir, err)
+	}
+	return len(chart.Dependencies) > 0, nil
+}
+
+// readChartFile reads a top-level file of a chart directory or packaged chart
+// Returns nil if the chart does not contain the file
+func readChartFile(chart, name string) ([]byte, error) {
+	info, err := os.Stat(chart)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		content, err := os.ReadFile(filepath.Join(chart, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return content, err
+	}
+
+	f, err := os.Open(chart)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The chart's own files sit directly below the top-level directory
+		if path.Base(header.Name) == name && path.Dir(path.Dir(header.Name)) == "." {
+			return io.ReadAll(tr)
+		}
+	}
+}
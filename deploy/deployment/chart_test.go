@@ -0,0 +1,229 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsLocalChart(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "local-chart-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	chartDir := filepath.Join(tmpDir, "myapp")
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		t.Fatalf("Failed to create chart directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: myapp\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Chart.yaml: %v", err)
+	}
+
+	testCases := []struct {
+		chart    string
+		expected bool
+	}{
+		{"./charts/myapp", true},
+		{"../charts/myapp", true},
+		{chartDir, true},
+		{"nginx", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		if got := IsLocalChart(tc.chart); got != tc.expected {
+			t.Errorf("IsLocalChart(%q) = %v, expected %v", tc.chart, got, tc.expected)
+		}
+	}
+}
+
+func writeLocalChart(t *testing.T, chartYAML string, withLock bool) string {
+	t.Helper()
+	chartDir, err := os.MkdirTemp("", "local-chart")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte(chartYAML), 0644); err != nil {
+		t.Fatalf("Failed to write Chart.yaml: %v", err)
+	}
+	if withLock {
+		if err := os.WriteFile(filepath.Join(chartDir, "Chart.lock"), []byte("dependencies: []\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Chart.lock: %v", err)
+		}
+	}
+	return chartDir
+}
+
+func TestHelmDeployer_Deploy_LocalChartWithDependencies(t *testing.T) {
+	chartDir := writeLocalChart(t, `apiVersion: v2
+name: myapp
+version: 0.1.0
+dependencies:
+  - name: redis
+    version: 17.x.x
+    repository: https://charts.bitnami.com/bitnami
+`, false)
+	defer os.RemoveAll(chartDir)
+
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("helm:get:manifest", []byte(""), errors.New("release not found"))
+
+	deployer := &HelmDeployer{
+		Common: Common{
+			Config: &config.Config{
+				AppName:     "test-app",
+				Chart:       chartDir,
+				Repository:  "https://charts.example.com",
+				ReleaseName: "test-release",
+				Namespace:   "test-namespace",
+			},
+			Cmd: mockCmd,
+		},
+	}
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error deploying local chart: %v", err)
+	}
+
+	foundDependencyBuild := false
+	foundUpgrade := false
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name != "helm" || len(cmd.Args) == 0 {
+			continue
+		}
+		switch cmd.Args[0] {
+		case "repo":
+			t.Errorf("Should not call helm repo commands for a local chart, but called: %v", cmd.Args)
+		case "dependency":
+			if len(cmd.Args) >= 3 && cmd.Args[1] == "build" && cmd.Args[2] == chartDir {
+				foundDependencyBuild = true
+			}
+		case "upgrade":
+			if len(cmd.Args) > 3 && cmd.Args[3] == chartDir {
+				foundUpgrade = true
+			}
+		}
+	}
+
+	if !foundDependencyBuild {
+		t.Errorf("Expected helm dependency build to be called for %s", chartDir)
+	}
+	if !foundUpgrade {
+		t.Errorf("Expected helm upgrade to use the local chart path %s", chartDir)
+	}
+}
+
+func TestChartHasDependencies(t *testing.T) {
+	noDeps := writeLocalChart(t, "apiVersion: v2\nname: myapp\nversion: 0.1.0\n", false)
+	defer os.RemoveAll(noDeps)
+	withLock := writeLocalChart(t, "apiVersion: v2\nname: myapp\nversion: 0.1.0\n", true)
+	defer os.RemoveAll(withLock)
+
+	if has, err := chartHasDependencies(noDeps); err != nil || has {
+		t.Errorf("Expected no dependencies, got %v (err: %v)", has, err)
+	}
+	if has, err := chartHasDependencies(withLock); err != nil || !has {
+		t.Errorf("Expected dependencies because of Chart.lock, got %v (err: %v)", has, err)
+	}
+}
+
+func TestRepoName(t *testing.T) {
+	name := RepoName("https://charts.example.com")
+	if !strings.HasPrefix(name, "helm-ci-") {
+		t.Errorf("Expected repository name to start with helm-ci-, got %q", name)
+	}
+	if name != RepoName("https://charts.example.com/") {
+		t.Errorf("Expected trailing slash to be ignored")
+	}
+	if name == RepoName("https://charts.other.com") {
+		t.Errorf("Expected different repositories to get different names")
+	}
+}
+
+func TestHelmDeployer_Deploy_IsolatedRepoConfig(t *testing.T) {
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("helm:get:manifest", []byte(""), errors.New("release not found"))
+
+	deployer := &HelmDeployer{
+		Common: Common{
+			Config: &config.Config{
+				AppName:     "test-app",
+				Chart:       "test-chart",
+				Repository:  "https://charts.example.com",
+				ReleaseName: "test-release",
+				Namespace:   "test-namespace",
+			},
+			Cmd: mockCmd,
+		},
+	}
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	name := RepoName("https://charts.example.com")
+	var repoConfig string
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name != "helm" || len(cmd.Args) < 3 {
+			continue
+		}
+
+		configIdx := -1
+		for i, arg := range cmd.Args {
+			if arg == "--repository-config" && i+1 < len(cmd.Args) {
+				configIdx = i + 1
+			}
+		}
+
+		switch {
+		case cmd.Args[0] == "repo" && cmd.Args[1] == "add":
+			if cmd.Args[2] != name {
+				t.Errorf("Expected repository to be added as %q, got %q", name, cmd.Args[2])
+			}
+			if configIdx < 0 {
+				t.Fatalf("helm repo add is missing --repository-config: %v", cmd.Args)
+			}
+			repoConfig = cmd.Args[configIdx]
+		case cmd.Args[0] == "repo" && cmd.Args[1] == "update":
+			if cmd.Args[2] != name {
+				t.Errorf("Expected only %q to be updated, got %v", name, cmd.Args)
+			}
+			if configIdx < 0 || cmd.Args[configIdx] != repoConfig {
+				t.Errorf("helm repo update does not use the private repository config: %v", cmd.Args)
+			}
+		case cmd.Args[0] == "upgrade":
+			if cmd.Args[3] != name+"/test-chart" {
+				t.Errorf("Expected chart reference %s/test-chart, got %s", name, cmd.Args[3])
+			}
+			if configIdx < 0 || cmd.Args[configIdx] != repoConfig {
+				t.Errorf("helm upgrade does not use the private repository config: %v", cmd.Args)
+			}
+		}
+	}
+
+	if repoConfig == "" {
+		t.Fatalf("Expected helm repo add to be called")
+	}
+	if _, err := os.Stat(filepath.Dir(repoConfig)); !os.IsNotExist(err) {
+		t.Errorf("Expected private repository config directory to be removed after deploy")
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"helm-ci/deploy/semver"
+	"helm-ci/deploy/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chartIndexEntry is a single chart version listed in a repository index.yaml
+type chartIndexEntry struct {
+	Version string   `yaml:"version"`
+	Digest  string   `yaml:"digest"`
+	URLs    []string `yaml:"urls"`
+}
+
+var (
+	challengeParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	linkNextRegex       = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+)
+
+// resolveChartVersion turns a version constraint such as "~1.4" or "latest-stable"
+// into an exact chart version by reading the repository index or the OCI tags.
+// Exact versions are returned unchanged.
+func (d *HelmDeployer) resolveChartVersion() (string, error) {
+	version := strings.TrimSpace(d.Config.Version)
+	if !semver.IsConstraint(version) {
+		return version, nil
+	}
+
+	if IsLocalChart(d.Config.Chart) {
+		utils.Log.Warningf("Ignoring version constraint %q for local chart %s", version, d.Config.Chart)
+		return "", nil
+	}
+
+	constraint, err := semver.ParseConstraint(version)
+	if err != nil {
+		return "", utils.NewError("invalid chart version constraint %q: %v", version, err)
+	}
+
+	var versions []string
+	if strings.HasPrefix(d.Config.Repository, "oci://") {
+		versions, err = d.listOCITags()
+	} else {
+		var entries []chartIndexEntry
+		entries, err = d.fetchIndexEntries()
+		for _, entry := range entries {
+			versions = append(versions, entry.Version)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	selected, err := constraint.Select(versions)
+	if err != nil {
+		return "", utils.NewError("failed to resolve version of chart %s: %v", d.Config.Chart, err)
+	}
+
+	utils.Log.Infof("Resolved chart version constraint %q to %s", version, selected.Original)
+	return selected.Original, nil
+}
+
+// repoHTTPClient returns an HTTP client that trusts the configured repository CA
+func (d *HelmDeployer) repoHTTPClient() (*http.Client, error) {
+	if d.Config.RepoCAFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	caData, err := os.ReadFile(d.Config.RepoCAFile)
+	if err != nil {
+		return nil, utils.NewError("failed to read repository CA file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, utils.NewError("no certificates found in repository CA file %s", d.Config.RepoCAFile)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// fetchIndexEntries downloads the repository index.yaml and returns the entries of the chart
+func (d *HelmDeployer) fetchIndexEntries() ([]chartIndexEntry, error) {
+	client, err := d.repoHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	indexURL := strings.TrimSuffix(d.Config.Repository, "/") + "/index.yaml"
+	req, err := http.NewRequest("GET", indexURL, nil)
+	if err != nil {
+		return nil, utils.NewError("failed to create index request: %v", err)
+	}
+	if creds := d.repoCreds; creds != nil {
+		if creds.token != "" && d.Config.RepoPassword == "" {
+			req.Header.Set("Authorization", "Bearer "+creds.token)
+		} else {
+			req.SetBasicAuth(creds.username, creds.password)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, utils.NewError("failed to download repository index %s: %v", indexURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewError("failed to download repository index %s: status %d", indexURL, resp.StatusCode)
+	}
+
+	var index struct {
+		Entries map[string][]chartIndexEntry `yaml:"entries"`
+	}
+	if err := yaml.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, utils.NewError("failed to parse repository index %s: %v", indexURL, err)
+	}
+
+	entries, ok := index.Entries[d.Config.Chart]
+	if !ok {
+		return nil, utils.NewError("chart %s not found in repository index %s", d.Config.Chart, indexURL)
+	}
+	return entries, nil
+}
+
+// listOCITags lists the tags of the chart in its OCI registry. Helm stores the
+// '+' of semver build metadata as '_' in tags, which is reverted here.
+func (d *HelmDeployer) listOCITags() ([]string, error) {
+	ref := strings.TrimSuffix(strings.TrimPrefix(d.Config.Repository, "oci://"), "/")
+	host, repoPath, _ := strings.Cut(ref, "/")
+	repository := strings.Trim(repoPath+"/"+d.Config.Chart, "/")
+
+	client, err := d.repoHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list", host, repository)
+	var tags []string
+	for next != "" {
+		resp, err := d.registryGet(client, next, repository)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, utils.NewError("failed to parse tag list of %s: %v", repository, err)
+		}
+
+		for _, tag := range result.Tags {
+			tags = append(tags, strings.ReplaceAll(tag, "_", "+"))
+		}
+
+		next = ""
+		if m := linkNextRegex.FindStringSubmatch(link); m != nil {
+			base, _ := url.Parse(fmt.Sprintf("https://%s/", host))
+			if nextURL, err := base.Parse(m[1]); err == nil {
+				next = nextURL.String()
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// registryGet performs a GET against an OCI registry, following the bearer token
+// challenge of the registry when it requires authentication
+func (d *HelmDeployer) registryGet(client *http.Client, target, repository string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, utils.NewError("failed to create registry request: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, utils.NewError("registry request to %s failed: %v", target, err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		req, _ = http.NewRequest("GET", target, nil)
+		if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			token, err := d.registryToken(client, challenge, repository)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if d.repoCreds != nil {
+			req.SetBasicAuth(d.repoCreds.username, d.repoCreds.password)
+		}
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, utils.NewError("registry request to %s failed: %v", target, err)
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, utils.NewError("registry request to %s failed: status %d", target, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// registryToken requests a pull token from the realm named in a bearer challenge
+func (d *HelmDeployer) registryToken(client *http.Client, challenge, repository string) (string, error) {
+	params := map[string]string{}
+	for _, m := range challengeParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", utils.NewError("registry returned a bearer challenge without realm")
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", utils.NewError("invalid registry token realm %q: %v", params["realm"], err)
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", utils.NewError("failed to create registry token request: %v", err)
+	}
+	if d.repoCreds != nil {
+		req.SetBasicAuth(d.repoCreds.username, d.repoCreds.password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", utils.NewError("registry token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", utils.NewError("registry token request failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", utils.NewError("failed to parse registry token response: %v", err)
+	}
+	if result.Token != "" {
+		return result.Token, nil
+	}
+	return result.AccessToken, nil
+}
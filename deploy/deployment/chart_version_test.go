@@ -0,0 +1,206 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"helm-ci/deploy/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testIndexYAML = `apiVersion: v1
+entries:
+  test-chart:
+    - version: 2.1.0
+      digest: sha256-210
+    - version: 1.4.7
+      digest: sha256-147
+    - version: 1.4.2
+      digest: sha256-142
+    - version: 1.5.0-rc.1
+      digest: sha256-150rc1
+  other-chart:
+    - version: 9.9.9
+`
+
+// writeServerCA stores the certificate of a TLS test server as PEM file
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemData, 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	return caFile
+}
+
+func TestResolveChartVersion_HTTPIndex(t *testing.T) {
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testIndexYAML)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		version     string
+		expected    string
+		expectError bool
+	}{
+		{"~1.4", "1.4.7", false},
+		{">=1.0 <2", "1.4.7", false},
+		{"latest-stable", "2.1.0", false},
+		{"1.4.2", "1.4.2", false},
+		{"", "", false},
+		{"~3", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			deployer := &HelmDeployer{
+				Common: Common{
+					Config: &config.Config{
+						Chart:      "test-chart",
+						Repository: server.URL,
+						Version:    tc.version,
+					},
+				},
+				repoCreds: &repoCredentials{username: "ci-user", password: "ci-token", token: "ci-token"},
+			}
+
+			version, err := deployer.resolveChartVersion()
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got version %s", tc.version, version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if version != tc.expected {
+				t.Errorf("Expected version %q, got %q", tc.expected, version)
+			}
+		})
+	}
+
+	if authHeader != "Bearer ci-token" {
+		t.Errorf("Expected bearer token authentication for the index, got %q", authHeader)
+	}
+}
+
+func TestResolveChartVersion_OCITags(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "ci-user" || pass != "ci-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:charts/test-chart:pull" {
+				t.Errorf("Unexpected token scope: %s", r.URL.Query().Get("scope"))
+			}
+			fmt.Fprint(w, `{"token":"pull-token"}`)
+		case r.URL.Path == "/v2/charts/test-chart/tags/list":
+			if r.Header.Get("Authorization") != "Bearer pull-token" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/charts/test-chart/tags/list?n=2&last=1.4.0>; rel="next"`)
+				fmt.Fprint(w, `{"name":"charts/test-chart","tags":["1.3.0","1.4.0"]}`)
+				return
+			}
+			fmt.Fprint(w, `{"name":"charts/test-chart","tags":["1.4.5_build.1","2.0.0"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	deployer := &HelmDeployer{
+		Common: Common{
+			Config: &config.Config{
+				Chart:      "test-chart",
+				Repository: "oci://" + host + "/charts",
+				Version:    "~1.4",
+				RepoCAFile: writeServerCA(t, server),
+			},
+		},
+		repoCreds: &repoCredentials{username: "ci-user", password: "ci-password"},
+	}
+
+	version, err := deployer.resolveChartVersion()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if version != "1.4.5+build.1" {
+		t.Errorf("Expected version 1.4.5+build.1, got %s", version)
+	}
+}
+
+func TestHelmDeployer_Deploy_RecordsResolvedVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testIndexYAML)
+	}))
+	defer server.Close()
+
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("helm:get:manifest", []byte(""), errors.New("release not found"))
+
+	summary := &Summary{}
+	deployer := &HelmDeployer{
+		Common: Common{
+			Config: &config.Config{
+				AppName:     "test-app",
+				Chart:       "test-chart",
+				Repository:  server.URL,
+				Version:     "~1.4",
+				ReleaseName: "test-release",
+				Namespace:   "test-namespace",
+			},
+			Cmd:     mockCmd,
+			Summary: summary,
+		},
+	}
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if version, _ := summary.Get("Chart version"); version != "1.4.7" {
+		t.Errorf("Expected summary to record chart version 1.4.7, got %q", version)
+	}
+
+	lastCmd, _ := mockCmd.GetLastCommand()
+	if !strings.Contains(strings.Join(lastCmd.Args, " "), "--version 1.4.7") {
+		t.Errorf("Expected helm upgrade to use the resolved version, got: %v", lastCmd.Args)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/utils"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClusterScopedKinds are the built-in kinds that have no namespace
+var ClusterScopedKinds = []string{
+	"APIService",
+	"CertificateSigningRequest",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ComponentStatus",
+	"CSIDriver",
+	"CSINode",
+	"CustomResourceDefinition",
+	"FlowSchema",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"Node",
+	"PersistentVolume",
+	"PriorityClass",
+	"PriorityLevelConfiguration",
+	"RuntimeClass",
+	"StorageClass",
+	"ValidatingAdmissionPolicy",
+	"ValidatingAdmissionPolicyBinding",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// loadClusterScopedKinds builds the registry of cluster-scoped kinds from the
+// built-in list, --cluster-scoped-kind and, if enabled, kubectl api-resources
+func (d *CustomDeployer) loadClusterScopedKinds() {
+	kinds := d.configuredClusterScopedKinds()
+
+	if d.Config.DiscoverClusterScoped {
+		cmd := d.Cmd.Command("kubectl", "api-resources", "--namespaced=false", "--no-headers")
+		output, err := d.Cmd.Output(cmd)
+		if err != nil {
+			utils.Log.Warningf("Failed to discover cluster-scoped kinds, using the built-in list: %v", err)
+		} else {
+			for _, kind := range parseAPIResourceKinds(output) {
+				kinds[kind] = true
+			}
+		}
+	}
+
+	d.clusterScoped = kinds
+}
+
+// configuredClusterScopedKinds returns the built-in and configured cluster-scoped kinds
+func (d *CustomDeployer) configuredClusterScopedKinds() map[string]bool {
+	kinds := make(map[string]bool, len(ClusterScopedKinds)+len(d.Config.ClusterScopedKinds))
+	for _, kind := range ClusterScopedKinds {
+		kinds[kind] = true
+	}
+	for _, kind := range d.Config.ClusterScopedKinds {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			kinds[kind] = true
+		}
+	}
+	return kinds
+}
+
+// isClusterScoped reports whether resources of a kind have no namespace
+func (d *CustomDeployer) isClusterScoped(kind string) bool {
+	if d.clusterScoped == nil {
+		d.clusterScoped = d.configuredClusterScopedKinds()
+	}
+	return d.clusterScoped[kind]
+}
+
+// parseAPIResourceKinds extracts the KIND column of `kubectl api-resources --no-headers`
+// The SHORTNAMES column may be empty, so the kind is the last field of each line
+func parseAPIResourceKinds(output []byte) []string {
+	var kinds []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		kinds = append(kinds, fields[len(fields)-1])
+	}
+	return kinds
+}
+
+// updateSubjectNamespaces points ServiceAccount subjects of a RoleBinding or
+// ClusterRoleBinding at the target namespace if they have no namespace or the
+// one the binding was written for. Subjects in other namespaces are kept.
+// Returns true if a subject was updated
+func (d *CustomDeployer) updateSubjectNamespaces(root *yaml.Node, originalNamespace string) bool {
+	subjects := findChildByKey(root, "subjects")
+	if subjects == nil || subjects.Kind != yaml.SequenceNode {
+		return false
+	}
+
+	updated := false
+	for _, subject := range subjects.Content {
+		kind := findChildByKey(subject, "kind")
+		if kind == nil || kind.Value != "ServiceAccount" {
+			continue
+		}
+
+		namespaceNode := findChildByKey(subject, "namespace")
+		if namespaceNode == nil {
+			subject.Content = append(subject.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "namespace"},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.Config.Namespace})
+			updated = true
+			continue
+		}
+		if namespaceNode.Value == d.Config.Namespace {
+			continue
+		}
+		if namespaceNode.Value == "" || namespaceNode.Value == originalNamespace {
+			utils.Log.Infof("Updated ServiceAccount subject namespace from '%s' to '%s'", namespaceNode.Value, d.Config.Namespace)
+			namespaceNode.Value = d.Config.Namespace
+			updated = true
+		}
+	}
+	return updated
+}
@@ -0,0 +1,186 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpdateNamespaceInDocument_ClusterScoped(t *testing.T) {
+	testCases := []struct {
+		name     string
+		kinds    []string
+		content  string
+		expected bool
+	}{
+		{
+			name:     "ClusterRole",
+			content:  "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: reader\n",
+			expected: false,
+		},
+		{
+			name:     "Namespace",
+			content:  "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: other\n",
+			expected: false,
+		},
+		{
+			name:     "configured kind",
+			kinds:    []string{"ClusterIssuer"},
+			content:  "apiVersion: cert-manager.io/v1\nkind: ClusterIssuer\nmetadata:\n  name: letsencrypt\n",
+			expected: false,
+		},
+		{
+			name:     "namespaced kind",
+			content:  "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: app\n",
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deployer := &CustomDeployer{Common: Common{Config: &config.Config{Namespace: "myapp-dev", ClusterScopedKinds: tc.kinds}}}
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.content), &doc); err != nil {
+				t.Fatalf("Failed to parse document: %v", err)
+			}
+
+			if updated := deployer.updateNamespaceInDocument(&doc); updated != tc.expected {
+				t.Errorf("Expected updated=%v, got %v", tc.expected, updated)
+			}
+			metadata := findChildByKey(doc.Content[0], "metadata")
+			if hasNamespace := findChildByKey(metadata, "namespace") != nil; hasNamespace != tc.expected {
+				t.Errorf("Expected namespace present=%v, got %v", tc.expected, hasNamespace)
+			}
+		})
+	}
+}
+
+func TestUpdateNamespaceInDocument_BindingSubjects(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "RoleBinding",
+			content: `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+  namespace: myapp
+subjects:
+- kind: ServiceAccount
+  name: app
+  namespace: myapp
+- kind: ServiceAccount
+  name: prometheus
+  namespace: monitoring
+- kind: User
+  name: jane
+roleRef:
+  kind: Role
+  name: app`,
+			expected: []string{"myapp-dev", "monitoring", ""},
+		},
+		{
+			name: "ClusterRoleBinding",
+			content: `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: app
+subjects:
+- kind: ServiceAccount
+  name: app
+- kind: ServiceAccount
+  name: coredns
+  namespace: kube-system
+roleRef:
+  kind: ClusterRole
+  name: reader`,
+			expected: []string{"myapp-dev", "kube-system"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deployer := &CustomDeployer{Common: Common{Config: &config.Config{Namespace: "myapp-dev"}}}
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.content), &doc); err != nil {
+				t.Fatalf("Failed to parse document: %v", err)
+			}
+			if !deployer.updateNamespaceInDocument(&doc) {
+				t.Fatal("Expected the document to be updated")
+			}
+
+			var binding struct {
+				Metadata struct {
+					Namespace string `yaml:"namespace"`
+				} `yaml:"metadata"`
+				Subjects []struct {
+					Namespace string `yaml:"namespace"`
+				} `yaml:"subjects"`
+			}
+			if err := doc.Decode(&binding); err != nil {
+				t.Fatalf("Failed to decode binding: %v", err)
+			}
+			if tc.name == "ClusterRoleBinding" && binding.Metadata.Namespace != "" {
+				t.Errorf("Expected no namespace on the ClusterRoleBinding, got %s", binding.Metadata.Namespace)
+			}
+			for i, subject := range binding.Subjects {
+				if subject.Namespace != tc.expected[i] {
+					t.Errorf("Expected subject %d namespace %q, got %q", i, tc.expected[i], subject.Namespace)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadClusterScopedKinds_Discovery(t *testing.T) {
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("kubectl:api-resources", []byte(
+		"clusterissuers                              cert-manager.io/v1    false   ClusterIssuer\n"+
+			"priorityclasses   pc                        scheduling.k8s.io/v1  false   PriorityClass\n"), nil)
+
+	deployer := &CustomDeployer{Common: Common{
+		Config: &config.Config{DiscoverClusterScoped: true},
+		Cmd:    mockCmd,
+	}}
+	deployer.loadClusterScopedKinds()
+
+	for _, kind := range []string{"ClusterIssuer", "PriorityClass", "ClusterRole"} {
+		if !deployer.isClusterScoped(kind) {
+			t.Errorf("Expected %s to be cluster-scoped", kind)
+		}
+	}
+	if deployer.isClusterScoped("Deployment") {
+		t.Error("Expected Deployment to be namespaced")
+	}
+
+	// A failed discovery falls back to the built-in registry
+	failing := NewMockCommander()
+	failing.AddResponse("kubectl:api-resources", nil, errors.New("connection refused"))
+	deployer = &CustomDeployer{Common: Common{
+		Config: &config.Config{DiscoverClusterScoped: true},
+		Cmd:    failing,
+	}}
+	deployer.loadClusterScopedKinds()
+	if !deployer.isClusterScoped("CustomResourceDefinition") || deployer.isClusterScoped("ClusterIssuer") {
+		t.Error("Expected only the built-in cluster-scoped kinds after a failed discovery")
+	}
+}
@@ -15,10 +15,9 @@
 package deployment
 
 import (
-	"bytes"
+	"helm-ci/deploy/manifest"
 	"helm-ci/deploy/utils"
 	"os"
-	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
@@ -26,26 +25,47 @@ import (
 // CustomDeployer implements custom Kubernetes manifest deployments
 type CustomDeployer struct {
 	Common
+	// clusterScoped is the registry of kinds that are never namespaced
+	clusterScoped map[string]bool
 }
 
 // Deploy implements the custom deployment
 func (d *CustomDeployer) Deploy() error {
-	stageManifests, err := filepath.Glob(filepath.Join(d.Config.ValuesPath, d.Config.Stage, "*.y*ml"))
-	if err != nil {
-		return utils.NewError("failed to glob stage manifests: %w", err)
-	}
+	var manifests []string
+	var patches []*manifestPatch
+	commonFiles := map[string]bool{}
+	kustomization := d.findKustomization()
+	if kustomization != "" {
+		// A kustomization replaces the individual manifest files
+		built, err := d.buildKustomization(kustomization)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(built)
+		manifests = []string{built}
+	} else {
+		stageManifests, commonManifests, err := d.manifestFiles()
+		if err != nil {
+			return err
+		}
+		manifests = append(stageManifests, commonManifests...)
+		for _, file := range commonManifests {
+			commonFiles[file] = true
+		}
 
-	commonManifests, err := filepath.Glob(filepath.Join(d.Config.ValuesPath, "common", "*.y*ml"))
-	if err != nil {
-		return utils.NewError("failed to glob common manifests: %w", err)
+		// Stage patches apply to the common manifests
+		if patches, err = d.loadPatches(); err != nil {
+			return err
+		}
 	}
-	manifests := append(stageManifests, commonManifests...)
+
+	d.loadClusterScopedKinds()
 
 	// Process manifests with Vault templating and update namespaces
-	processedManifests := make([]string, 0, len(manifests))
+	sources := make([]manifestSource, 0, len(manifests))
 	for _, manifest := range manifests {
-		// First process with Vault templating
-		processedFile, err := d.ProcessValuesFileWithVault(manifest)
+		// First process with Vault templating; Secrets built by kustomize are encoded already
+		processedFile, err := d.processFile(manifest, kustomization == "")
 		if err != nil {
 			return err
 		}
@@ -53,7 +73,19 @@ func (d *CustomDeployer) Deploy() error {
 			defer os.Remove(processedFile)
 		}
 
-		// Then update namespaces in the processed file
+		// Then apply the stage patches to common manifests
+		if commonFiles[manifest] {
+			patchedFile, err := applyPatches(processedFile, patches)
+			if err != nil {
+				return err
+			}
+			if patchedFile != processedFile {
+				defer os.Remove(patchedFile)
+				processedFile = patchedFile
+			}
+		}
+
+		// Then update namespaces and standard metadata in the processed file
 		finalFile, err := d.updateNamespaces(processedFile)
 		if err != nil {
 			return err
@@ -62,12 +94,63 @@ func (d *CustomDeployer) Deploy() error {
 			defer os.Remove(finalFile)
 		}
 
-		processedManifests = append(processedManifests, finalFile)
+		source := manifestSource{file: manifest, processed: finalFile, common: commonFiles[manifest]}
+		if kustomization != "" {
+			source.file = kustomization
+		}
+		sources = append(sources, source)
+	}
+	if err := unappliedPatches(patches); err != nil {
+		return err
+	}
+
+	// Generated ConfigMaps and Secrets get hash-suffixed names the workloads are pointed at
+	generated, generatedNames, err := d.generateResources()
+	if err != nil {
+		return err
+	}
+	if generated != "" {
+		defer os.Remove(generated)
+		finalFile, err := d.updateNamespaces(generated)
+		if err != nil {
+			return err
+		}
+		if finalFile != generated {
+			defer os.Remove(finalFile)
+		}
+		sources = append(sources, manifestSource{file: d.generatorsPath(), processed: finalFile})
+	}
+
+	// Stage definitions replace common ones, then resources are applied in
+	// install order, custom resources after their CRDs
+	ordered, origins, err := d.resolveDuplicates(sources)
+	if err != nil {
+		return err
+	}
+	rewriteGeneratedReferences(ordered, generatedNames)
+	if err := d.overrideImages(ordered); err != nil {
+		return err
+	}
+	if err := d.validateManifests(ordered, origins); err != nil {
+		return err
+	}
+	if err := d.checkDeprecatedAPIs(ordered); err != nil {
+		return err
+	}
+	sortManifests(ordered)
+	phases, err := applyPhases(ordered)
+	if err != nil {
+		return err
+	}
+	for _, phase := range phases {
+		defer os.Remove(phase.file)
 	}
 
 	// Check if namespace exists, create if it doesn't
 	cmd := d.Cmd.Command("kubectl", "get", "namespace", d.Config.Namespace)
-	if err := d.Cmd.Run(cmd); err != nil {
+	if err := d.Cmd.Run(cmd); err != nil && d.Config.Plan {
+		utils.Log.Infof("Namespace %s does not exist and would be created", d.Config.Namespace)
+	} else if err != nil {
 		utils.Green("Namespace %s does not exist, creating it...", d.Config.Namespace)
 		cmd = d.Cmd.Command("kubectl", "create", "namespace", d.Config.Namespace)
 		cmd.Stdout = os.Stdout
@@ -77,10 +160,34 @@ func (d *CustomDeployer) Deploy() error {
 		}
 	}
 
+	// Resources recorded by the previous deployment but gone from the manifests
+	current := d.resourceIDs(ordered)
+	var stale []ResourceID
+	if d.Config.Prune {
+		inventory, err := d.loadInventory()
+		if err != nil {
+			return err
+		}
+		stale = staleResources(inventory, current)
+	}
+
 	// Show diff first
 	utils.Green("Showing differences:")
-	if err := d.GetDiff(processedManifests, false); err != nil {
-		return err
+	for i, phase := range phases {
+		if err := d.GetDiff([]string{phase.file}, false); err != nil {
+			// Custom resources of CRDs that are not installed yet cannot be diffed
+			if i > 0 && len(phases[0].crds) > 0 {
+				utils.Log.Warning("Custom resources can be compared once their CRDs are installed, proceeding")
+				continue
+			}
+			return err
+		}
+	}
+	showDeletions(stale, d.Config.PruneDryRun)
+
+	if d.Config.Plan {
+		utils.Green("Plan mode, nothing was applied")
+		return nil
 	}
 
 	// Check if we should proceed
@@ -89,13 +196,23 @@ func (d *CustomDeployer) Deploy() error {
 	}
 
 	// Proceed with actual deployment
-	for _, manifest := range processedManifests {
-		cmd := d.Cmd.Command("kubectl", "apply", "-f", manifest, "-n", d.Config.Namespace)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	for _, phase := range phases {
+		if err := d.applyManifest(phase.file); err != nil {
+			return err
+		}
+		if err := d.waitForCRDs(phase.crds); err != nil {
+			return err
+		}
+	}
 
-		if err := d.Cmd.Run(cmd); err != nil {
-			return utils.NewError("failed to apply manifest %s: %v", manifest, err)
+	// Delete what was removed and record what is deployed now
+	if d.Config.Prune {
+		remaining, err := d.prune(stale)
+		if err != nil {
+			return err
+		}
+		if err := d.saveInventory(append(current, remaining...)); err != nil {
+			return err
 		}
 	}
 
@@ -104,92 +221,54 @@ func (d *CustomDeployer) Deploy() error {
 
 // updateNamespaces processes YAML manifest files and ensures that
 // metadata.namespace is set to the correct namespace for each resource
+// and that every resource carries the standard labels and annotations
 func (d *CustomDeployer) updateNamespaces(manifestFile string) (string, error) {
+	metadata := d.standardMetadata()
+
 	// Read the manifest file
 	content, err := os.ReadFile(manifestFile)
 	if err != nil {
 		return "", utils.NewError("failed to read manifest file %s: %v", manifestFile, err)
 	}
 
-	// Split the file into YAML documents
-	yamlDocuments := bytes.Split(content, []byte("---"))
-	if len(yamlDocuments) == 0 {
-		return manifestFile, nil // Empty file
-	}
-
-	// Track if any document was updated
-	updated := false
-	updatedDocuments := make([][]byte, 0, len(yamlDocuments))
-
-	// Process each document separately
-	for _, docBytes := range yamlDocuments {
-		// Skip empty documents
-		if len(bytes.TrimSpace(docBytes)) == 0 {
-			updatedDocuments = append(updatedDocuments, docBytes)
+	// Process each document separately; invalid documents are kept as they are
+	documents := manifest.Read(content)
+	for _, doc := range documents {
+		if doc.Err != nil {
+			utils.Log.Warningf("Skipping invalid YAML document in %s: %v", manifestFile, doc.Err)
 			continue
 		}
-
-		// Try to parse the document
-		var docNode yaml.Node
-		err := yaml.Unmarshal(docBytes, &docNode)
-		if err != nil {
-			// Skip invalid YAML documents
-			utils.Log.Warningf("Skipping invalid YAML document in %s: %v", manifestFile, err)
-			updatedDocuments = append(updatedDocuments, docBytes) // Keep original
+		if doc.Node == nil {
 			continue
 		}
 
-		// Skip empty documents
-		if docNode.Kind == 0 || len(docNode.Content) == 0 {
-			updatedDocuments = append(updatedDocuments, docBytes)
-			continue
+		if d.updateNamespaceInDocument(doc.Node) {
+			doc.Changed = true
 		}
-
-		// Process this document
-		docUpdated := d.updateNamespaceInDocument(&docNode)
-		if docUpdated {
-			updated = true
+		if metadata != nil && metadata.Apply(doc.Node) {
+			doc.Changed = true
 		}
-
-		// Serialize the document back to YAML
-		var buf bytes.Buffer
-		enc := yaml.NewEncoder(&buf)
-		enc.SetIndent(2)
-		err = enc.Encode(&docNode)
-		enc.Close()
-		if err != nil {
-			utils.Log.Warningf("Failed to encode document in %s: %v", manifestFile, err)
-			updatedDocuments = append(updatedDocuments, docBytes) // Keep original
-			continue
-		}
-
-		updatedDocuments = append(updatedDocuments, buf.Bytes())
 	}
 
 	// If no updates were made, return the original file
-	if !updated {
+	if !manifest.Changed(documents) {
 		return manifestFile, nil
 	}
 
+	updated, err := manifest.Write(documents)
+	if err != nil {
+		return "", utils.NewError("failed to encode manifest %s: %v", manifestFile, err)
+	}
+
 	// Create a temporary file for the updated manifest
 	tmpFile, err := os.CreateTemp("", "manifest-*.yml")
 	if err != nil {
 		return "", utils.NewError("failed to create temporary file: %v", err)
 	}
-
-	// Join the documents with the --- separator
-	separator := []byte("\n---\n")
-	for i, doc := range updatedDocuments {
-		if i > 0 {
-			if _, err := tmpFile.Write(separator); err != nil {
-				os.Remove(tmpFile.Name())
-				return "", utils.NewError("failed to write document separator: %v", err)
-			}
-		}
-		if _, err := tmpFile.Write(doc); err != nil {
-			os.Remove(tmpFile.Name())
-			return "", utils.NewError("failed to write document: %v", err)
-		}
+	if _, err := tmpFile.Write(updated); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to write manifest: %v", err)
 	}
 
 	if err := tmpFile.Close(); err != nil {
@@ -201,7 +280,8 @@ func (d *CustomDeployer) updateNamespaces(manifestFile string) (string, error) {
 }
 
 // updateNamespaceInDocument updates the namespace in a single YAML document
-// Returns true if the document was updated
+// Cluster-scoped resources keep their metadata; ServiceAccount subjects of
+// role bindings follow the namespace. Returns true if the document was updated
 func (d *CustomDeployer) updateNamespaceInDocument(doc *yaml.Node) bool {
 	// Only process mapping nodes (key-value pairs)
 	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
@@ -214,6 +294,19 @@ func (d *CustomDeployer) updateNamespaceInDocument(doc *yaml.Node) bool {
 		return false
 	}
 
+	// Cluster-scoped resources have no namespace
+	kind := ""
+	if kindNode := findChildByKey(root, "kind"); kindNode != nil {
+		kind = kindNode.Value
+	}
+	if d.isClusterScoped(kind) {
+		utils.Log.Debugf("Keeping cluster-scoped %s without namespace", kind)
+		if kind == "ClusterRoleBinding" {
+			return d.updateSubjectNamespaces(root, "")
+		}
+		return false
+	}
+
 	// Look for metadata field in the mapping
 	metadataNode := findChildByKey(root, "metadata")
 	if metadataNode == nil || metadataNode.Kind != yaml.MappingNode {
@@ -221,16 +314,17 @@ func (d *CustomDeployer) updateNamespaceInDocument(doc *yaml.Node) bool {
 	}
 
 	// Look for namespace field in metadata
+	updated := false
+	originalNamespace := ""
 	namespaceNode := findChildByKey(metadataNode, "namespace")
 	if namespaceNode != nil {
 		// Update existing namespace
+		originalNamespace = namespaceNode.Value
 		if namespaceNode.Value != d.Config.Namespace {
-			oldNamespace := namespaceNode.Value
 			namespaceNode.Value = d.Config.Namespace
-			utils.Log.Infof("Updated namespace from '%s' to '%s'", oldNamespace, d.Config.Namespace)
-			return true
+			utils.Log.Infof("Updated namespace from '%s' to '%s'", originalNamespace, d.Config.Namespace)
+			updated = true
 		}
-		return false
 	} else {
 		// Add namespace field if not found
 		keyNode := &yaml.Node{
@@ -245,8 +339,13 @@ func (d *CustomDeployer) updateNamespaceInDocument(doc *yaml.Node) bool {
 		}
 		metadataNode.Content = append(metadataNode.Content, keyNode, valueNode)
 		utils.Log.Infof("Added namespace '%s'", d.Config.Namespace)
-		return true
+		updated = true
+	}
+
+	if kind == "RoleBinding" && d.updateSubjectNamespaces(root, originalNamespace) {
+		updated = true
 	}
+	return updated
 }
 
 // findChildByKey returns the child node with the given key in a mapping node
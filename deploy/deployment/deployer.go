@@ -20,6 +20,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/templates"
 	"helm-ci/deploy/utils"
 	"helm-ci/deploy/vault"
 	"io"
@@ -27,6 +29,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -38,22 +41,34 @@ type Deployer interface {
 
 // Common contains shared functionality for all deployers
 type Common struct {
-	Config *config.Config
-	Cmd    Commander
+	Config  *config.Config
+	Cmd     Commander
+	Summary *Summary
+	// StartedAt is the deploy timestamp recorded on deployed resources
+	StartedAt time.Time
 }
 
 // NewCommon creates a new Common with default configuration
 func NewCommon(cfg *config.Config) Common {
 	return Common{
-		Config: cfg,
-		Cmd:    &RealCommander{},
+		Config:    cfg,
+		Cmd:       &RealCommander{},
+		Summary:   &Summary{},
+		StartedAt: time.Now(),
 	}
 }
 
-// ProcessValuesFileWithVault processes a values file with Vault templating
+// ProcessValuesFileWithVault processes a values file with template rendering and Vault templating
 func (c *Common) ProcessValuesFileWithVault(filename string) (string, error) {
-	// If Vault URL is not configured, return the original file
-	if c.Config.VaultURL == "" {
+	return c.processFile(filename, true)
+}
+
+// processFile renders a file and resolves its Vault placeholders into a temporary file
+// With encodeSecrets the data of Secrets is base64 encoded afterwards; kustomize
+// output has it encoded already.
+func (c *Common) processFile(filename string, encodeSecrets bool) (string, error) {
+	// If neither templating nor Vault is configured, return the original file
+	if c.Config.VaultURL == "" && !c.Config.RenderTemplates {
 		utils.Log.Debug("No Vault URL configured, using original values file")
 		return filename, nil
 	}
@@ -64,56 +79,19 @@ func (c *Common) ProcessValuesFileWithVault(filename string) (string, error) {
 		return "", utils.NewError("failed to read values file %s: %v", filename, err)
 	}
 
-	// Create Vault client
-	vaultClient, err := vault.NewClient(
-		c.Config.VaultURL,
-		c.Config.VaultToken,
-		c.Config.VaultBasePath,
-		c.Config.VaultKVVersion,
-		c.Config.VaultInsecureTLS,
-	)
-	if err != nil {
-		return "", utils.NewError("failed to initialize vault client: %w", err)
+	var processedContent string
+	if encodeSecrets {
+		processedContent, err = c.processContent(filename, content)
+	} else {
+		processedContent, err = c.processPlaceholders(filename, content)
 	}
-
-	// Process the content using the new method
-	processedContent, err := vaultClient.ProcessString(string(content))
 	if err != nil {
-		return "", utils.NewError("failed to process vault templates in file %s: %w", filename, err)
-	}
-
-	// Check if this is a Kubernetes Secret
-	if strings.Contains(processedContent, "kind: Secret") {
-		// Parse the YAML
-		var secret map[string]interface{}
-		err = yaml.Unmarshal([]byte(processedContent), &secret)
-		if err != nil {
-			return "", utils.NewError("failed to parse Secret YAML: %v", err)
-		}
-
-		// Get the data section
-		if data, ok := secret["data"].(map[string]interface{}); ok {
-			// Base64 encode each value
-			for k, v := range data {
-				if str, ok := v.(string); ok {
-					data[k] = base64.StdEncoding.EncodeToString([]byte(str))
-				}
-			}
-			// Update the secret with encoded values
-			secret["data"] = data
-		}
-
-		// Convert back to YAML
-		yamlBytes, err := yaml.Marshal(secret)
-		if err != nil {
-			return "", utils.NewError("failed to marshal Secret YAML: %v", err)
-		}
-		processedContent = string(yamlBytes)
+		return "", err
 	}
 
 	if c.Config.DEBUG {
 		utils.Log.Debugln("Processed content:")
-		fmt.Println(processedContent)
+		fmt.Println(utils.MaskSecrets(processedContent))
 	}
 
 	// Create a temporary file for the processed values
@@ -132,6 +110,142 @@ func (c *Common) ProcessValuesFileWithVault(filename string) (string, error) {
 	return tmpFile.Name(), nil
 }
 
+// processContent renders the content of a file as template if enabled and
+// then resolves its Vault placeholders
+func (c *Common) processContent(filename string, content []byte) (string, error) {
+	rendered, err := c.renderTemplate(filename, content)
+	if err != nil {
+		return "", err
+	}
+	return c.resolveVaultContent(filename, string(rendered))
+}
+
+// processPlaceholders renders the content of a file as template if enabled and
+// then resolves its Vault placeholders, leaving Secrets as they are
+func (c *Common) processPlaceholders(filename string, content []byte) (string, error) {
+	rendered, err := c.renderTemplate(filename, content)
+	if err != nil {
+		return "", err
+	}
+	return c.resolveVaultPlaceholders(filename, string(rendered))
+}
+
+// renderTemplate renders content as Go template when --render-templates is set
+func (c *Common) renderTemplate(filename string, content []byte) ([]byte, error) {
+	if !c.Config.RenderTemplates {
+		return content, nil
+	}
+	return templates.Render(filename, content, templates.NewData(c.Config))
+}
+
+// resolveVaultContent resolves Vault placeholders and base64 encodes the data of Secrets
+func (c *Common) resolveVaultContent(filename string, content string) (string, error) {
+	if c.Config.VaultURL == "" {
+		return content, nil
+	}
+
+	processedContent, err := c.resolveVaultPlaceholders(filename, content)
+	if err != nil {
+		return "", err
+	}
+
+	// Base64 encode the data of every Kubernetes Secret in the file
+	documents := manifest.Read([]byte(processedContent))
+	for _, doc := range documents {
+		if doc.Kind() != "Secret" {
+			continue
+		}
+		if encodeSecretData(doc.Root()) {
+			doc.Changed = true
+		}
+	}
+	if manifest.Changed(documents) {
+		encoded, err := manifest.Write(documents)
+		if err != nil {
+			return "", utils.NewError("failed to marshal Secret YAML: %v", err)
+		}
+		processedContent = string(encoded)
+	}
+
+	return processedContent, nil
+}
+
+// resolveVaultPlaceholders resolves the Vault placeholders in content
+func (c *Common) resolveVaultPlaceholders(filename string, content string) (string, error) {
+	if c.Config.VaultURL == "" {
+		return content, nil
+	}
+
+	// Create Vault client
+	vaultClient, err := c.newVaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	// Process the content using the new method
+	processedContent, err := vaultClient.ProcessString(content)
+	if err != nil {
+		return "", utils.NewError("failed to process vault templates in file %s: %w", filename, err)
+	}
+	return processedContent, nil
+}
+
+// encodeSecretData base64 encodes the scalar values in the data of a Secret
+// Returns true if any value was encoded
+func encodeSecretData(secret *yaml.Node) bool {
+	data := findChildByKey(secret, "data")
+	if data == nil || data.Kind != yaml.MappingNode {
+		return false
+	}
+
+	updated := false
+	for i := 1; i < len(data.Content); i += 2 {
+		value := data.Content[i]
+		if value.Kind != yaml.ScalarNode || value.Tag == "!!null" {
+			continue
+		}
+		*value = yaml.Node{
+			Kind:  yaml.ScalarNode,
+			Tag:   "!!str",
+			Value: base64.StdEncoding.EncodeToString([]byte(value.Value)),
+		}
+		updated = true
+	}
+	return updated
+}
+
+// newVaultClient creates a Vault client from the configuration
+func (c *Common) newVaultClient() (*vault.Client, error) {
+	vaultClient, err := vault.NewClient(
+		c.Config.VaultURL,
+		c.Config.VaultToken,
+		c.Config.VaultBasePath,
+		c.Config.VaultKVVersion,
+		c.Config.VaultInsecureTLS,
+	)
+	if err != nil {
+		return nil, utils.NewError("failed to initialize vault client: %w", err)
+	}
+	return vaultClient, nil
+}
+
+// ResolvePlaceholders resolves Vault placeholders in a single value such as a
+// credential or a --set value. Values without placeholders are returned unchanged.
+func (c *Common) ResolvePlaceholders(value string) (string, error) {
+	if !vault.HasPlaceholder(value) {
+		return value, nil
+	}
+	if c.Config.VaultURL == "" {
+		return "", utils.NewError("value contains a vault placeholder but no Vault URL is configured")
+	}
+
+	vaultClient, err := c.newVaultClient()
+	if err != nil {
+		return "", err
+	}
+	return vaultClient.ProcessString(value)
+}
+
 // SetupRootCA sets up the root CA certificate
 func (c *Common) SetupRootCA() error {
 	if c.Config.RootCA == "" {
@@ -261,12 +375,14 @@ func (c *Common) GetDiff(args []string, isHelm bool) error {
 			dryRunArgs := append(args, "--dry-run")
 			cmd := c.Cmd.Command("helm", dryRunArgs...)
 
-			// Capture both stdout and stderr while also displaying them
+			// Capture both stdout and stderr, and show them with secrets masked
 			var stdoutBuf, stderrBuf bytes.Buffer
-			cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
-			cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
+			cmd.Stdout = &stdoutBuf
+			cmd.Stderr = &stderrBuf
 
 			err := c.Cmd.Run(cmd)
+			fmt.Fprint(os.Stdout, utils.MaskSecrets(stdoutBuf.String()))
+			fmt.Fprint(os.Stderr, utils.MaskSecrets(stderrBuf.String()))
 			if err != nil {
 				// Check if this error is related to missing CRDs
 				errStr := stderrBuf.String()
@@ -299,21 +415,53 @@ func (c *Common) GetDiff(args []string, isHelm bool) error {
 			return utils.NewError("failed to extract YAML content: %v", err)
 		}
 
-		return utils.ShowResourceDiff(current, proposedYAML, c.Config.DEBUG)
-	} else {
-		for _, manifest := range args {
-			cmd := c.Cmd.Command("kubectl", "diff", "-f", manifest, "-n", c.Config.Namespace)
-			output, err := c.Cmd.CombinedOutput(cmd)
+		rules, err := utils.ParseDiffIgnoreRules(c.Config.DiffIgnore, c.Config.DiffIgnoreDefaults)
+		if err != nil {
+			return err
+		}
 
-			utils.Green("\nDiff for %s:\n", manifest)
-			fmt.Println(utils.ColorizeKubectlDiff(string(output)))
+		return utils.ShowManifestDiff(current, proposedYAML, rules, c.Config.DEBUG)
+	}
 
-			if err != nil {
-				if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
-					return utils.NewError("failed to get diff for %s: %v", manifest, err)
-				}
+	// Compare the live objects with the result of a server-side dry-run apply,
+	// so the ignore rules apply to custom manifests as well
+	rules, err := utils.ParseDiffIgnoreRules(c.Config.DiffIgnore, c.Config.DiffIgnoreDefaults)
+	if err != nil {
+		return err
+	}
+	for _, manifest := range args {
+		liveCmd := c.Cmd.Command("kubectl", "get", "-f", manifest, "-n", c.Config.Namespace, "-o", "yaml", "--ignore-not-found")
+		live, err := c.Cmd.Output(liveCmd)
+		if err != nil {
+			return utils.NewError("failed to get the live state of %s: %v", manifest, kubectlError(err))
+		}
+
+		dryRunArgs := append([]string{"apply"}, c.serverSideArgs()...)
+		dryRunArgs = append(dryRunArgs, "--dry-run=server", "-o", "yaml", "-f", manifest, "-n", c.Config.Namespace)
+		proposed, err := c.Cmd.Output(c.Cmd.Command("kubectl", dryRunArgs...))
+		if err != nil {
+			output := string(proposed)
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				output += string(exitErr.Stderr)
+			}
+			if conflictErr := c.conflictError(output); conflictErr != nil {
+				return conflictErr
 			}
+			return utils.NewError("failed to get diff for %s: %v", manifest, kubectlError(err))
+		}
+
+		utils.Green("\nDiff for %s:\n", manifest)
+		if err := utils.ShowManifestDiff(live, proposed, rules, c.Config.DEBUG); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// kubectlError adds what kubectl wrote to stderr to its error
+func kubectlError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(utils.MaskSecrets(string(exitErr.Stderr))))
+	}
+	return err
+}
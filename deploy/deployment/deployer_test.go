@@ -15,10 +15,14 @@
 package deployment
 
 import (
+	"bytes"
+	"encoding/base64"
 	"errors"
 	"helm-ci/deploy/config"
+	"helm-ci/deploy/utils"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -432,7 +436,7 @@ func TestCustomDeployer_Deploy_NoManifests(t *testing.T) {
 	}
 }
 
-func TestGetDiff_KubectlDiffError(t *testing.T) {
+func TestGetDiff_KubectlDryRunError(t *testing.T) {
 	// Create a config
 	cfg := &config.Config{
 		Namespace: "test-namespace",
@@ -441,12 +445,12 @@ func TestGetDiff_KubectlDiffError(t *testing.T) {
 	// Create a mock commander
 	mockCmd := NewMockCommander()
 
-	// Make kubectl diff return error other than exit code 1
+	// Make the server-side dry-run apply fail
 	exitErr := &ExitError{
-		Err:       errors.New("kubectl diff failed"),
-		CodeValue: 2, // Something other than 1, which is expected for diffs
+		Err:       errors.New("kubectl apply failed"),
+		CodeValue: 1,
 	}
-	mockCmd.AddResponse("kubectl:diff", []byte("error output"), exitErr)
+	mockCmd.AddResponse("kubectl:apply", []byte("error output"), exitErr)
 
 	// Create a Common instance
 	common := Common{
@@ -459,7 +463,7 @@ func TestGetDiff_KubectlDiffError(t *testing.T) {
 
 	// Expect an error
 	if err == nil {
-		t.Errorf("Expected error when kubectl diff fails with non-1 exit code, got nil")
+		t.Fatalf("Expected error when the dry-run apply fails, got nil")
 	}
 
 	// Verify the error message contains expected text
@@ -468,6 +472,62 @@ func TestGetDiff_KubectlDiffError(t *testing.T) {
 	}
 }
 
+func TestGetDiff_KubectlIgnoreRules(t *testing.T) {
+	cfg := &config.Config{
+		Namespace:          "test-namespace",
+		DiffIgnore:         []string{"spec.replicas"},
+		DiffIgnoreDefaults: true,
+	}
+
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("kubectl:get", []byte(`apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: web
+    resourceVersion: "4711"
+    annotations:
+      checksum/config: aaaa
+  spec:
+    replicas: 5
+`), nil)
+	mockCmd.AddResponse("kubectl:apply", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  resourceVersion: "4712"
+  annotations:
+    checksum/config: bbbb
+spec:
+  replicas: 2
+`), nil)
+
+	var buf bytes.Buffer
+	origLogOut := utils.Log.Out
+	utils.Log.SetOutput(&buf)
+	defer utils.Log.SetOutput(origLogOut)
+
+	common := Common{Config: cfg, Cmd: mockCmd}
+	if err := common.GetDiff([]string{"manifest.yml"}, false); err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "0 to change") || !strings.Contains(buf.String(), "1 unchanged") {
+		t.Errorf("Expected the ignore rules to apply to the kubectl diff, got: %s", buf.String())
+	}
+
+	var dryRun bool
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "kubectl" && cmd.Args[0] == "apply" {
+			dryRun = slices.Contains(cmd.Args, "--dry-run=server")
+		}
+	}
+	if !dryRun {
+		t.Errorf("Expected a server-side dry-run apply, got %v", mockCmd.Commands)
+	}
+}
+
 func TestGetDiff_HelmDryRunError(t *testing.T) {
 	// Create a config
 	cfg := &config.Config{
@@ -527,3 +587,107 @@ func TestHelmDeployer_GetRootCAArgs(t *testing.T) {
 		t.Errorf("Expected empty args as implementation is commented out, got %v", args)
 	}
 }
+
+func TestProcessValuesFileWithVault_RendersTemplatesFirst(t *testing.T) {
+	server := newVaultTestServer(t, map[string]string{
+		"/v1/secret/data/app/live": `{"data": {"data": {"PASSWORD": "rendered-secret"}}}`,
+	})
+
+	valuesFile := filepath.Join(t.TempDir(), "live.yaml")
+	content := "release: {{ .ReleaseName }}\npassword: <<vault.app/{{ .Stage }}/PASSWORD>>\n"
+	if err := os.WriteFile(valuesFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write values file: %v", err)
+	}
+
+	common := Common{
+		Config: &config.Config{
+			ReleaseName:     "myapp",
+			Stage:           "live",
+			RenderTemplates: true,
+			VaultURL:        server.URL,
+			VaultBasePath:   "secret",
+			VaultKVVersion:  2,
+		},
+		Cmd: &RealCommander{},
+	}
+
+	processedFile, err := common.ProcessValuesFileWithVault(valuesFile)
+	if err != nil {
+		t.Fatalf("ProcessValuesFileWithVault failed: %v", err)
+	}
+	defer os.Remove(processedFile)
+
+	processed, err := os.ReadFile(processedFile)
+	if err != nil {
+		t.Fatalf("Failed to read processed file: %v", err)
+	}
+	if string(processed) != "release: myapp\npassword: rendered-secret\n" {
+		t.Errorf("Unexpected processed content:\n%s", processed)
+	}
+}
+
+func TestProcessValuesFileWithVault_EncodesEverySecret(t *testing.T) {
+	server := newVaultTestServer(t, map[string]string{
+		"/v1/secret/data/db": `{"data": {"data": {"USER": "db-user", "PASSWORD": "db-password"}}}`,
+	})
+
+	manifestFile := filepath.Join(t.TempDir(), "secrets.yaml")
+	content := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: notes
+data:
+  README.md: |
+    Intro
+    ---
+    Details
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db-user
+data:
+  username: <<vault.db/USER>>
+---
+# Password of the database
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db-password
+data:
+  password: <<vault.db/PASSWORD>>
+`
+	if err := os.WriteFile(manifestFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	common := Common{
+		Config: &config.Config{
+			VaultURL:       server.URL,
+			VaultBasePath:  "secret",
+			VaultKVVersion: 2,
+		},
+		Cmd: &RealCommander{},
+	}
+
+	processedFile, err := common.ProcessValuesFileWithVault(manifestFile)
+	if err != nil {
+		t.Fatalf("ProcessValuesFileWithVault failed: %v", err)
+	}
+	defer os.Remove(processedFile)
+
+	processed, err := os.ReadFile(processedFile)
+	if err != nil {
+		t.Fatalf("Failed to read processed file: %v", err)
+	}
+	for _, expected := range []string{
+		"    Intro\n    ---\n    Details\n",
+		"username: " + base64.StdEncoding.EncodeToString([]byte("db-user")),
+		"# Password of the database\n",
+		"password: " + base64.StdEncoding.EncodeToString([]byte("db-password")),
+	} {
+		if !strings.Contains(string(processed), expected) {
+			t.Errorf("Expected %q in processed manifest, got:\n%s", expected, processed)
+		}
+	}
+}
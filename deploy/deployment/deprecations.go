@@ -0,0 +1,183 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/semver"
+	"helm-ci/deploy/utils"
+	"slices"
+	"strings"
+)
+
+// DeprecatedAPI is an API version of a kind that Kubernetes deprecated and removes
+type DeprecatedAPI struct {
+	APIVersion   string
+	Kind         string
+	DeprecatedIn string
+	RemovedIn    string
+	// Replacement is the API version to migrate to, empty if the kind has no successor
+	Replacement string
+}
+
+// DeprecatedAPIs follows the Kubernetes deprecated API migration guide
+var DeprecatedAPIs = []DeprecatedAPI{
+	{"extensions/v1beta1", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "DaemonSet", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.10", "1.16", "policy/v1beta1"},
+	{"extensions/v1beta1", "Ingress", "1.14", "1.22", "networking.k8s.io/v1"},
+	{"apps/v1beta1", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", "1.19", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass", "1.19", "1.22", "networking.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", "1.17", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", "1.14", "1.22", "coordination.k8s.io/v1"},
+	{"batch/v1beta1", "CronJob", "1.21", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event", "1.19", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "1.22", "1.25", "autoscaling/v2"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "1.23", "1.26", "autoscaling/v2"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.21", "1.25", ""},
+	{"node.k8s.io/v1beta1", "RuntimeClass", "1.20", "1.25", "node.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "1.24", "1.27", "storage.k8s.io/v1"},
+}
+
+// apiFinding is a resource using a deprecated or removed API
+type apiFinding struct {
+	resource string
+	api      DeprecatedAPI
+	removed  bool
+}
+
+func (f apiFinding) String() string {
+	state := "deprecated since " + f.api.DeprecatedIn + ", removed in " + f.api.RemovedIn
+	if f.removed {
+		state = "removed in " + f.api.RemovedIn
+	}
+	replacement := "no replacement"
+	if f.api.Replacement != "" {
+		replacement = "use " + f.api.Replacement
+	}
+	return fmt.Sprintf("%s uses %s, %s, %s", f.resource, f.api.APIVersion, state, replacement)
+}
+
+// findDeprecatedAPIs returns the resources whose API is deprecated or removed in the Kubernetes version
+func findDeprecatedAPIs(docs []*manifest.Document, kubeVersion *semver.Version) ([]apiFinding, error) {
+	var findings []apiFinding
+	for _, doc := range docs {
+		for _, api := range DeprecatedAPIs {
+			if doc.APIVersion() != api.APIVersion || doc.Kind() != api.Kind {
+				continue
+			}
+			deprecatedIn, err := semver.Parse(api.DeprecatedIn)
+			if err != nil {
+				return nil, err
+			}
+			removedIn, err := semver.Parse(api.RemovedIn)
+			if err != nil {
+				return nil, err
+			}
+			if kubeVersion.Compare(deprecatedIn) < 0 {
+				break
+			}
+			findings = append(findings, apiFinding{
+				resource: api.Kind + "/" + resourceName(doc),
+				api:      api,
+				removed:  kubeVersion.Compare(removedIn) >= 0,
+			})
+			break
+		}
+	}
+	return findings, nil
+}
+
+// checkDeprecatedAPIs reports the deprecated and removed APIs in the manifests for
+// --kube-version. Findings fail the deployment of a protected stage and are
+// warnings otherwise, and always in plan mode.
+func (c *Common) checkDeprecatedAPIs(docs []*manifest.Document) error {
+	if c.Config.KubeVersion == "" {
+		return nil
+	}
+	kubeVersion, err := semver.Parse(c.Config.KubeVersion)
+	if err != nil {
+		return utils.NewError("invalid Kubernetes version %q: %v", c.Config.KubeVersion, err)
+	}
+	findings, err := findDeprecatedAPIs(docs, kubeVersion)
+	if err != nil {
+		return utils.NewError("invalid deprecated API table: %v", err)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	if !c.Config.Plan && slices.Contains(c.Config.ProtectedStages, c.Config.Stage) {
+		return utils.NewError("deprecated APIs for Kubernetes %s in protected stage %s:\n  %s",
+			c.Config.KubeVersion, c.Config.Stage, strings.Join(messages, "\n  "))
+	}
+	utils.Log.Warningf("Deprecated APIs for Kubernetes %s:", c.Config.KubeVersion)
+	for _, message := range messages {
+		utils.Log.Warningf("  %s", message)
+	}
+	c.Summary.Set("Deprecated APIs", strings.Join(messages, ", "))
+	return nil
+}
+
+// checkRenderedAPIs renders the chart with helm template for --kube-version
+// and checks the output for deprecated APIs
+func (d *HelmDeployer) checkRenderedAPIs(args []string) error {
+	if d.Config.KubeVersion == "" {
+		return nil
+	}
+	// args start with upgrade --install <release>
+	templateArgs := append([]string{"template", d.Config.ReleaseName}, args[3:]...)
+	templateArgs = append(templateArgs, "--kube-version", d.Config.KubeVersion)
+	cmd := d.Cmd.Command("helm", templateArgs...)
+	output, err := d.Cmd.Output(cmd)
+	if err != nil {
+		return utils.NewError("failed to render chart for Kubernetes %s: %v", d.Config.KubeVersion, err)
+	}
+	return d.checkDeprecatedAPIs(manifest.Read(output))
+}
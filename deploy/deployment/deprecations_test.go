@@ -0,0 +1,228 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/semver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDeprecatedManifests = `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+
+func TestFindDeprecatedAPIs(t *testing.T) {
+	docs := manifest.Read([]byte(testDeprecatedManifests))
+	tests := []struct {
+		version  string
+		expected []string
+	}{
+		{
+			version: "1.13.0",
+		},
+		{
+			version: "1.24.3",
+			expected: []string{
+				"Ingress/web uses extensions/v1beta1, removed in 1.22, use networking.k8s.io/v1",
+				"PodDisruptionBudget/web uses policy/v1beta1, deprecated since 1.21, removed in 1.25, use policy/v1",
+				"HorizontalPodAutoscaler/web uses autoscaling/v2beta2, deprecated since 1.23, removed in 1.26, use autoscaling/v2",
+			},
+		},
+		{
+			version: "v1.26",
+			expected: []string{
+				"Ingress/web uses extensions/v1beta1, removed in 1.22, use networking.k8s.io/v1",
+				"PodDisruptionBudget/web uses policy/v1beta1, removed in 1.25, use policy/v1",
+				"HorizontalPodAutoscaler/web uses autoscaling/v2beta2, removed in 1.26, use autoscaling/v2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			version, err := semver.Parse(tt.version)
+			if err != nil {
+				t.Fatalf("Failed to parse version: %v", err)
+			}
+			findings, err := findDeprecatedAPIs(docs, version)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(findings) != len(tt.expected) {
+				t.Fatalf("Expected %d findings, got %v", len(tt.expected), findings)
+			}
+			for i, finding := range findings {
+				if finding.String() != tt.expected[i] {
+					t.Errorf("Expected %q, got %q", tt.expected[i], finding.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDeprecatedAPIs(t *testing.T) {
+	docs := manifest.Read([]byte(testDeprecatedManifests))
+	tests := []struct {
+		name      string
+		stage     string
+		plan      bool
+		expectErr bool
+	}{
+		{name: "protected stage", stage: "live", expectErr: true},
+		{name: "protected stage in plan mode", stage: "live", plan: true},
+		{name: "unprotected stage", stage: "dev"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Common{
+				Config: &config.Config{
+					Stage:           tt.stage,
+					KubeVersion:     "1.25.0",
+					Plan:            tt.plan,
+					ProtectedStages: []string{"live"},
+				},
+				Summary: &Summary{},
+			}
+
+			err := c.checkDeprecatedAPIs(docs)
+			if tt.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "protected stage live") {
+					t.Errorf("Expected the protected stage to fail, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected warnings only, got %v", err)
+			}
+			if deprecated, _ := c.Summary.Get("Deprecated APIs"); !strings.Contains(deprecated, "Ingress/web") {
+				t.Errorf("Expected the findings in the summary, got %q", deprecated)
+			}
+		})
+	}
+}
+
+func TestHelmDeployer_Deploy_DeprecatedAPIs(t *testing.T) {
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{
+		Repository:      "https://charts.example.com",
+		Stage:           "live",
+		KubeVersion:     "1.25.0",
+		ProtectedStages: []string{"live"},
+	})
+	deployer.Summary = &Summary{}
+	mockCmd.AddResponse("helm:template", []byte(testDeprecatedManifests), nil)
+
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "PodDisruptionBudget/web uses policy/v1beta1") {
+		t.Fatalf("Expected the deprecated PodDisruptionBudget to fail the deploy, got %v", err)
+	}
+
+	var templateArgs string
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && cmd.Args[0] == "upgrade" {
+			t.Error("Expected no helm upgrade")
+		}
+		if cmd.Name == "helm" && cmd.Args[0] == "template" {
+			templateArgs = strings.Join(cmd.Args, " ")
+		}
+	}
+	if !strings.HasPrefix(templateArgs, "template test-release ") || !strings.HasSuffix(templateArgs, " --kube-version 1.25.0") {
+		t.Errorf("Unexpected helm template arguments: %q", templateArgs)
+	}
+}
+
+// mutatingCommands returns the commands that would change the cluster
+func mutatingCommands(mockCmd *MockCommander) []string {
+	var mutating []string
+	for _, cmd := range mockCmd.Commands {
+		args := strings.Join(cmd.Args, " ")
+		if strings.Contains(args, "--dry-run") {
+			continue
+		}
+		switch cmd.Args[0] {
+		case "create", "apply", "delete", "upgrade", "install":
+			mutating = append(mutating, cmd.Name+" "+args)
+		}
+	}
+	return mutating
+}
+
+func TestDeploy_PlanChangesNothing(t *testing.T) {
+	rootCA := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(rootCA, []byte("certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write root CA: %v", err)
+	}
+
+	t.Run("helm", func(t *testing.T) {
+		deployer, mockCmd := newAuthTestDeployer(&config.Config{
+			Repository: "https://charts.example.com",
+			Stage:      "live",
+			RootCA:     rootCA,
+			Plan:       true,
+		})
+		deployer.Summary = &Summary{}
+
+		if err := deployer.Deploy(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if mutating := mutatingCommands(mockCmd); len(mutating) != 0 {
+			t.Errorf("Expected no changes in plan mode, got %v", mutating)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		dir := t.TempDir()
+		writeManifests(t, dir, map[string]string{
+			"live/settings.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+		})
+		mockCmd := NewMockCommander()
+		mockCmd.AddResponse("kubectl:get:namespace", nil, errors.New("namespace not found"))
+		deployer := &CustomDeployer{Common: Common{
+			Config:  &config.Config{ValuesPath: dir, Stage: "live", Namespace: "web", ReleaseName: "web", Prune: true, Plan: true},
+			Cmd:     mockCmd,
+			Summary: &Summary{},
+		}}
+
+		if err := deployer.Deploy(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if mutating := mutatingCommands(mockCmd); len(mutating) != 0 {
+			t.Errorf("Expected no changes in plan mode, got %v", mutating)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/utils"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultManifestIncludes are the files discovered as manifests when no include pattern is given
+var DefaultManifestIncludes = []string{"*.y*ml"}
+
+// DefaultManifestExcludes are never discovered as manifests, on top of the configured excludes
+var DefaultManifestExcludes = []string{"*.example.yaml", "*.example.yml"}
+
+// manifestFiles discovers the manifests of the stage and the common manifests
+func (d *CustomDeployer) manifestFiles() ([]string, []string, error) {
+	include := d.Config.ManifestInclude
+	if len(include) == 0 {
+		include = DefaultManifestIncludes
+	}
+	exclude := append(append([]string{}, DefaultManifestExcludes...), d.Config.ManifestExclude...)
+
+	// The stage patches are applied to the common manifests, not deployed themselves
+	stageManifests, err := discoverManifests(filepath.Join(d.Config.ValuesPath, d.Config.Stage), include, exclude, patchesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	commonManifests, err := discoverManifests(filepath.Join(d.Config.ValuesPath, "common"), include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	utils.Log.Debugf("Manifest files:")
+	for _, file := range append(append([]string{}, stageManifests...), commonManifests...) {
+		utils.Log.Debugf("  %s", file)
+	}
+	return stageManifests, commonManifests, nil
+}
+
+// discoverManifests walks a directory recursively and returns the files that
+// match an include pattern and no exclude pattern, ordered by numeric prefix.
+// skipDirs are top-level directories that are not searched. A missing
+// directory has no manifests.
+func discoverManifests(dir string, include, exclude []string, skipDirs ...string) ([]string, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, utils.NewError("invalid manifest pattern %q: %v", pattern, err)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			for _, skip := range skipDirs {
+				if rel == skip {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if matchesAny(include, rel) && !matchesAny(exclude, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, utils.NewError("failed to discover manifests in %s: %v", dir, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return lessManifestPath(files[i], files[j]) })
+	for i, rel := range files {
+		files[i] = filepath.Join(dir, filepath.FromSlash(rel))
+	}
+	return files, nil
+}
+
+// matchesAny reports whether a slash-separated relative path matches one of the patterns
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches a relative path against a glob pattern
+// Patterns without a slash match the file name in any directory,
+// others match the whole path where ** stands for any number of directories
+func matchPattern(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// lessManifestPath orders relative paths segment by segment, numeric prefixes
+// such as the 00 of 00-namespace.yaml numerically and before names without one
+func lessManifestPath(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aok := numericPrefix(as[i])
+		bn, bok := numericPrefix(bs[i])
+		switch {
+		case aok && bok && an != bn:
+			return an < bn
+		case aok != bok:
+			return aok
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// numericPrefix returns the number a file or directory name starts with
+func numericPrefix(name string) (int, bool) {
+	end := 0
+	for end < len(name) && name[end] >= '0' && name[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[:end])
+	return n, err == nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifestFiles(t *testing.T) {
+	dir := t.TempDir()
+	manifest := "kind: ConfigMap\nmetadata:\n  name: settings\n"
+	writeManifests(t, dir, map[string]string{
+		"live/10-app.yaml":               manifest,
+		"live/2-rbac.yml":                manifest,
+		"live/00-namespace.yaml":         manifest,
+		"live/web.yaml":                  manifest,
+		"live/web.example.yaml":          manifest,
+		"live/README.md":                 "docs",
+		"live/monitoring/01-alerts.yaml": manifest,
+		"live/legacy/old.yaml":           manifest,
+		"live/patches/replicas.yaml":     manifest,
+		"common/base/service.yaml":       manifest,
+		"common/deployment.yaml":         manifest,
+	})
+
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{
+		ValuesPath:      dir,
+		Stage:           "live",
+		ManifestExclude: []string{"legacy/**"},
+	}}}
+
+	stage, common, err := deployer.manifestFiles()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedStage := []string{
+		filepath.Join(dir, "live", "00-namespace.yaml"),
+		filepath.Join(dir, "live", "2-rbac.yml"),
+		filepath.Join(dir, "live", "10-app.yaml"),
+		filepath.Join(dir, "live", "monitoring", "01-alerts.yaml"),
+		filepath.Join(dir, "live", "web.yaml"),
+	}
+	if !reflect.DeepEqual(stage, expectedStage) {
+		t.Errorf("Expected stage manifests %v, got %v", expectedStage, stage)
+	}
+	expectedCommon := []string{
+		filepath.Join(dir, "common", "base", "service.yaml"),
+		filepath.Join(dir, "common", "deployment.yaml"),
+	}
+	if !reflect.DeepEqual(common, expectedCommon) {
+		t.Errorf("Expected common manifests %v, got %v", expectedCommon, common)
+	}
+}
+
+func TestManifestFiles_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		"dev/app/deployment.yaml": "kind: Deployment\n",
+		"dev/app/values.yaml":     "replicas: 1\n",
+		"dev/service.yaml":        "kind: Service\n",
+	})
+
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{
+		ValuesPath:      dir,
+		Stage:           "dev",
+		ManifestInclude: []string{"**/deployment.yaml", "service.yaml"},
+	}}}
+
+	stage, common, err := deployer.manifestFiles()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "dev", "app", "deployment.yaml"), filepath.Join(dir, "dev", "service.yaml")}
+	if !reflect.DeepEqual(stage, expected) || len(common) != 0 {
+		t.Errorf("Expected stage manifests %v and no common ones, got %v and %v", expected, stage, common)
+	}
+
+	deployer.Config.ManifestInclude = []string{"[invalid"}
+	if _, _, err := deployer.manifestFiles(); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.yaml", "deployment.yaml", true},
+		{"*.yaml", "app/deployment.yaml", true},
+		{"app/*.yaml", "app/deployment.yaml", true},
+		{"app/*.yaml", "app/nested/deployment.yaml", false},
+		{"app/**", "app/nested/deployment.yaml", true},
+		{"**/crds/*.yaml", "crds/crd.yaml", true},
+		{"**/crds/*.yaml", "a/b/crds/crd.yaml", true},
+		{"**/crds/*.yaml", "a/crds/b/crd.yaml", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.path); got != tt.match {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+}
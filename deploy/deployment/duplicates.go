@@ -0,0 +1,107 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"strings"
+)
+
+// manifestSource is a manifest file and the processed copy of it that is applied
+type manifestSource struct {
+	// file is the manifest as found in the values path
+	file string
+	// processed is the file after Vault templating, patches and namespace updates
+	processed string
+	// common is set for manifests shared by all stages
+	common bool
+}
+
+// documentOrigin locates a document in the manifests, index counts the
+// non-empty documents of the file from 1
+type documentOrigin struct {
+	file  string
+	index int
+}
+
+func (o documentOrigin) String() string {
+	return fmt.Sprintf("%s (document %d)", o.file, o.index)
+}
+
+// resolveDuplicates reads the processed manifests and resolves resources that
+// are defined more than once. A stage definition replaces the common one, and
+// of duplicates within the stage or within common the later one is applied.
+// In strict mode any duplicate is an error. The origin of every returned
+// document is recorded for error messages.
+func (d *CustomDeployer) resolveDuplicates(sources []manifestSource) ([]*manifest.Document, map[*manifest.Document]documentOrigin, error) {
+	var docs []*manifest.Document
+	var origins []*manifestSource
+	located := map[*manifest.Document]documentOrigin{}
+	seen := map[ResourceID]int{}
+	var duplicates []string
+
+	for i := range sources {
+		source := &sources[i]
+		fileDocs, err := readManifest(source.processed)
+		if err != nil {
+			return nil, nil, err
+		}
+		for index, doc := range fileDocs {
+			located[doc] = documentOrigin{file: source.file, index: index + 1}
+			id, ok := d.resourceID(doc)
+			if !ok {
+				docs = append(docs, doc)
+				origins = append(origins, source)
+				continue
+			}
+			key := id.identity()
+			prev, found := seen[key]
+			if !found {
+				seen[key] = len(docs)
+				docs = append(docs, doc)
+				origins = append(origins, source)
+				continue
+			}
+
+			first := origins[prev]
+			switch {
+			case d.Config.StrictDuplicates:
+				if first.file == source.file {
+					duplicates = append(duplicates, fmt.Sprintf("%s is defined twice in %s", id, source.file))
+				} else {
+					duplicates = append(duplicates, fmt.Sprintf("%s is defined in %s and %s", id, first.file, source.file))
+				}
+			case first.common == source.common:
+				// Like kubectl applying both, the later definition wins
+				utils.Log.Warningf("%s is defined in %s and again in %s, applying the latter", id, first.file, source.file)
+				docs[prev] = doc
+				origins[prev] = source
+			case first.common:
+				utils.Log.Infof("%s in %s overrides the common definition in %s", id, source.file, first.file)
+				docs[prev] = doc
+				origins[prev] = source
+			default:
+				utils.Log.Infof("%s in %s overrides the common definition in %s", id, first.file, source.file)
+			}
+		}
+	}
+
+	if len(duplicates) > 0 {
+		return nil, nil, utils.NewError("duplicate resources in the manifests:\n  %s", strings.Join(duplicates, "\n  "))
+	}
+	return docs, located, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newDuplicateTestSources(t *testing.T, stage, common string) []manifestSource {
+	t.Helper()
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{"live/web.yaml": stage, "common/web.yaml": common})
+	stageFile := filepath.Join(dir, "live", "web.yaml")
+	commonFile := filepath.Join(dir, "common", "web.yaml")
+	return []manifestSource{
+		{file: stageFile, processed: stageFile},
+		{file: commonFile, processed: commonFile, common: true},
+	}
+}
+
+func TestResolveDuplicates_StageOverridesCommon(t *testing.T) {
+	sources := newDuplicateTestSources(t,
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+		"apiVersion: apps/v1beta2\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n---\n"+
+			"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: other\n---\n"+
+			"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n")
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{Namespace: "web"}}}
+
+	docs, _, err := deployer.resolveDuplicates(sources)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var resources []string
+	for _, doc := range docs {
+		id, _ := deployer.resourceID(doc)
+		resources = append(resources, id.String())
+	}
+	expected := "Deployment/web/web Deployment/other/web Service/web/web"
+	if strings.Join(resources, " ") != expected {
+		t.Errorf("Expected resources %q, got %q", expected, strings.Join(resources, " "))
+	}
+	if !strings.Contains(string(docs[0].Raw()), "replicas: 3") {
+		t.Errorf("Expected the stage definition to win, got:\n%s", docs[0].Raw())
+	}
+}
+
+func TestResolveDuplicates_SameOriginKeepsLater(t *testing.T) {
+	sources := newDuplicateTestSources(t,
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n---\n"+
+			"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n")
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{Namespace: "web"}}}
+
+	docs, _, err := deployer.resolveDuplicates(sources)
+	if err != nil {
+		t.Fatalf("Expected duplicates within common to be logged only, got %v", err)
+	}
+	if len(docs) != 2 || !strings.Contains(string(docs[1].Raw()), "replicas: 2") {
+		t.Errorf("Expected the later definition to be applied, got %d documents", len(docs))
+	}
+}
+
+func TestResolveDuplicates_Errors(t *testing.T) {
+	deployment := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"
+	tests := []struct {
+		name     string
+		stage    string
+		common   string
+		strict   bool
+		expected string
+	}{
+		{
+			name:     "strict mode",
+			stage:    deployment,
+			common:   deployment,
+			strict:   true,
+			expected: "common/web.yaml",
+		},
+		{
+			name:     "twice in the stage",
+			stage:    deployment + "---\n" + deployment,
+			common:   "",
+			strict:   true,
+			expected: "Deployment/web/web is defined twice in",
+		},
+		{
+			name:     "twice in common",
+			stage:    "",
+			common:   deployment + "---\n" + deployment,
+			strict:   true,
+			expected: "Deployment/web/web is defined twice in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := newDuplicateTestSources(t, tt.stage, tt.common)
+			deployer := &CustomDeployer{Common: Common{Config: &config.Config{Namespace: "web", StrictDuplicates: tt.strict}}}
+
+			_, _, err := deployer.resolveDuplicates(sources)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// generatorsFile declares the generated ConfigMaps and Secrets of custom deployments
+const generatorsFile = "generators.yaml"
+
+// generatorConfig is the content of the generators file
+type generatorConfig struct {
+	ConfigMaps []generator `yaml:"configMapGenerator"`
+	Secrets    []generator `yaml:"secretGenerator"`
+}
+
+// generator declares a ConfigMap or Secret built from files and literals
+type generator struct {
+	Name string `yaml:"name"`
+	// Type is the Secret type, Opaque if empty
+	Type string `yaml:"type"`
+	// Files are paths relative to the generators file, as path or key=path
+	Files []string `yaml:"files"`
+	// Literals are key=value pairs
+	Literals []string `yaml:"literals"`
+	// DisableNameSuffixHash keeps the name as it is
+	DisableNameSuffixHash bool `yaml:"disableNameSuffixHash"`
+}
+
+// generatedName identifies a generated object by kind and declared name
+type generatedName struct {
+	Kind string
+	Name string
+}
+
+// generatorsPath returns --generators, or generators.yaml in the values path
+// if present, or "" if there are no generators
+func (d *CustomDeployer) generatorsPath() string {
+	if d.Config.Generators != "" {
+		return d.Config.Generators
+	}
+	path := filepath.Join(d.Config.ValuesPath, generatorsFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+	return path
+}
+
+// generateResources builds the ConfigMaps and Secrets declared in --generators,
+// or generators.yaml in the values path, after template and Vault processing.
+// The objects are written to a temporary manifest file, "" if nothing is declared,
+// and the returned map holds the hash-suffixed name of every generated object.
+func (d *CustomDeployer) generateResources() (string, map[generatedName]string, error) {
+	path := d.generatorsPath()
+	if path == "" {
+		return "", nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, utils.NewError("failed to read generators %s: %v", path, err)
+	}
+	processed, err := d.processContent(path, content)
+	if err != nil {
+		return "", nil, err
+	}
+	var config generatorConfig
+	if err := yaml.Unmarshal([]byte(processed), &config); err != nil {
+		return "", nil, utils.NewError("failed to parse generators %s: %v", path, err)
+	}
+
+	names := map[generatedName]string{}
+	var docs []*manifest.Document
+	for _, kind := range []string{"ConfigMap", "Secret"} {
+		generators := config.ConfigMaps
+		if kind == "Secret" {
+			generators = config.Secrets
+		}
+		for _, gen := range generators {
+			id := generatedName{Kind: kind, Name: gen.Name}
+			if gen.Name == "" {
+				return "", nil, utils.NewError("%s generator in %s needs a name", kind, path)
+			}
+			if _, found := names[id]; found {
+				return "", nil, utils.NewError("%s generator %s is declared twice in %s", kind, gen.Name, path)
+			}
+
+			data, err := d.generatorData(filepath.Dir(path), gen)
+			if err != nil {
+				return "", nil, utils.NewError("%s generator %s: %v", kind, gen.Name, err)
+			}
+			object := generatedObject(kind, gen, data)
+			name := gen.Name
+			if !gen.DisableNameSuffixHash {
+				if name, err = hashedName(gen.Name, object); err != nil {
+					return "", nil, err
+				}
+			}
+			object["metadata"] = map[string]interface{}{"name": name}
+			names[id] = name
+			utils.Log.Infof("Generated %s/%s", kind, name)
+
+			var node yaml.Node
+			if err := node.Encode(object); err != nil {
+				return "", nil, utils.NewError("failed to encode %s %s: %v", kind, name, err)
+			}
+			docs = append(docs, &manifest.Document{Node: &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}, Changed: true})
+		}
+	}
+	if len(docs) == 0 {
+		return "", nil, nil
+	}
+
+	file, err := writeManifestFile(docs)
+	if err != nil {
+		return "", nil, err
+	}
+	return file, names, nil
+}
+
+// generatorData reads the files and literals of a generator into a key/value map
+func (d *CustomDeployer) generatorData(dir string, gen generator) (map[string]string, error) {
+	data := map[string]string{}
+	add := func(key, value string) error {
+		if key == "" {
+			return utils.NewError("empty key")
+		}
+		if _, found := data[key]; found {
+			return utils.NewError("key %s is defined twice", key)
+		}
+		data[key] = value
+		return nil
+	}
+
+	for _, source := range gen.Files {
+		key, file, found := strings.Cut(source, "=")
+		if !found {
+			key, file = filepath.Base(source), source
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, utils.NewError("failed to read %s: %v", file, err)
+		}
+		value := string(content)
+		if utf8.Valid(content) {
+			if value, err = d.processContent(file, content); err != nil {
+				return nil, err
+			}
+		}
+		if err := add(key, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, literal := range gen.Literals {
+		key, value, found := strings.Cut(literal, "=")
+		if !found {
+			return nil, utils.NewError("literal %q is not key=value", literal)
+		}
+		if err := add(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// generatedObject returns the ConfigMap or Secret without metadata
+// Secret data is base64 encoded, as is ConfigMap content that is not UTF-8
+func generatedObject(kind string, gen generator, data map[string]string) map[string]interface{} {
+	object := map[string]interface{}{"apiVersion": "v1", "kind": kind}
+	if kind == "Secret" {
+		secretType := gen.Type
+		if secretType == "" {
+			secretType = "Opaque"
+		}
+		encoded := make(map[string]string, len(data))
+		for key, value := range data {
+			encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		object["type"] = secretType
+		object["data"] = encoded
+		return object
+	}
+
+	text := map[string]string{}
+	binary := map[string]string{}
+	for key, value := range data {
+		if utf8.ValidString(value) {
+			text[key] = value
+		} else {
+			binary[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	object["data"] = text
+	if len(binary) > 0 {
+		object["binaryData"] = binary
+	}
+	return object
+}
+
+// hashedName appends a hash of the object's content to the name, so that
+// changed content yields a new object and the workloads using it roll out
+func hashedName(name string, object map[string]interface{}) (string, error) {
+	// JSON encodes map keys sorted, which makes the hash stable
+	content, err := json.Marshal(object)
+	if err != nil {
+		return "", utils.NewError("failed to hash %s: %v", name, err)
+	}
+	sum := sha256.Sum256(content)
+	return name + "-" + hex.EncodeToString(sum[:])[:10], nil
+}
+
+// rewriteGeneratedReferences points the ConfigMap and Secret references of
+// workloads at the hash-suffixed names of generated objects
+func rewriteGeneratedReferences(docs []*manifest.Document, names map[generatedName]string) {
+	if len(names) == 0 {
+		return
+	}
+	for _, doc := range docs {
+		podSpec := findPodSpec(doc)
+		if podSpec == nil {
+			continue
+		}
+		rename := func(node *yaml.Node, kind, key string) {
+			if node == nil {
+				return
+			}
+			ref := findChildByKey(node, key)
+			if ref == nil {
+				return
+			}
+			if name, found := names[generatedName{Kind: kind, Name: ref.Value}]; found {
+				utils.Log.Debugf("%s/%s now references %s/%s", doc.Kind(), resourceName(doc), kind, name)
+				ref.Value = name
+				doc.Changed = true
+			}
+		}
+
+		for _, volume := range sequenceItems(podSpec, "volumes") {
+			rename(findChildByKey(volume, "configMap"), "ConfigMap", "name")
+			rename(findChildByKey(volume, "secret"), "Secret", "secretName")
+			if projected := findChildByKey(volume, "projected"); projected != nil {
+				for _, source := range sequenceItems(projected, "sources") {
+					rename(findChildByKey(source, "configMap"), "ConfigMap", "name")
+					rename(findChildByKey(source, "secret"), "Secret", "name")
+				}
+			}
+		}
+		for _, pullSecret := range sequenceItems(podSpec, "imagePullSecrets") {
+			rename(pullSecret, "Secret", "name")
+		}
+		for _, list := range containerLists {
+			for _, container := range sequenceItems(podSpec, list) {
+				for _, env := range sequenceItems(container, "env") {
+					if valueFrom := findChildByKey(env, "valueFrom"); valueFrom != nil {
+						rename(findChildByKey(valueFrom, "configMapKeyRef"), "ConfigMap", "name")
+						rename(findChildByKey(valueFrom, "secretKeyRef"), "Secret", "name")
+					}
+				}
+				for _, envFrom := range sequenceItems(container, "envFrom") {
+					rename(findChildByKey(envFrom, "configMapRef"), "ConfigMap", "name")
+					rename(findChildByKey(envFrom, "secretRef"), "Secret", "name")
+				}
+			}
+		}
+	}
+}
+
+// sequenceItems returns the items of the sequence under key, or nil
+func sequenceItems(node *yaml.Node, key string) []*yaml.Node {
+	child := findChildByKey(node, key)
+	if child == nil || child.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return child.Content
+}
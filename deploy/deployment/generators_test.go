@@ -0,0 +1,172 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"encoding/base64"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testGenerators = `configMapGenerator:
+- name: app-config
+  files:
+  - config/app.properties
+  - settings.json=config/defaults.json
+  literals:
+  - LOG_LEVEL=info
+- name: static
+  disableNameSuffixHash: true
+  literals:
+  - MODE=static
+secretGenerator:
+- name: app-secrets
+  literals:
+  - PASSWORD=<<vault.app/PASSWORD>>
+`
+
+type generatedObjectFields struct {
+	Kind     string                `yaml:"kind"`
+	Type     string                `yaml:"type"`
+	Metadata struct{ Name string } `yaml:"metadata"`
+	Data     map[string]string     `yaml:"data"`
+}
+
+func generateTestResources(t *testing.T, properties string) ([]generatedObjectFields, map[generatedName]string) {
+	t.Helper()
+	server := newVaultTestServer(t, map[string]string{
+		"/v1/secret/data/app": `{"data": {"data": {"PASSWORD": "s3cret"}}}`,
+	})
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		generatorsFile:          testGenerators,
+		"config/app.properties": properties,
+		"config/defaults.json":  "{}",
+	})
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{
+		ValuesPath:     dir,
+		VaultURL:       server.URL,
+		VaultBasePath:  "secret",
+		VaultKVVersion: 2,
+	}}}
+
+	file, names, err := deployer.generateResources()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(file)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read generated manifests: %v", err)
+	}
+
+	var objects []generatedObjectFields
+	for _, doc := range manifest.Read(content) {
+		var object generatedObjectFields
+		if err := doc.Root().Decode(&object); err != nil {
+			t.Fatalf("Failed to decode generated object: %v", err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, names
+}
+
+func TestGenerateResources(t *testing.T) {
+	objects, names := generateTestResources(t, "color=blue\n")
+	if len(objects) != 3 {
+		t.Fatalf("Expected 3 generated objects, got %d", len(objects))
+	}
+
+	configMap := objects[0]
+	if configMap.Metadata.Name != names[generatedName{Kind: "ConfigMap", Name: "app-config"}] ||
+		!strings.HasPrefix(configMap.Metadata.Name, "app-config-") || len(configMap.Metadata.Name) != len("app-config-")+10 {
+		t.Errorf("Expected a hash-suffixed name, got %q", configMap.Metadata.Name)
+	}
+	if configMap.Data["app.properties"] != "color=blue\n" || configMap.Data["settings.json"] != "{}" || configMap.Data["LOG_LEVEL"] != "info" {
+		t.Errorf("Unexpected ConfigMap data: %v", configMap.Data)
+	}
+	if objects[1].Metadata.Name != "static" {
+		t.Errorf("Expected the name without hash, got %q", objects[1].Metadata.Name)
+	}
+
+	secret := objects[2]
+	password, _ := base64.StdEncoding.DecodeString(secret.Data["PASSWORD"])
+	if secret.Kind != "Secret" || secret.Type != "Opaque" || string(password) != "s3cret" {
+		t.Errorf("Expected an Opaque Secret with the Vault password, got %+v", secret)
+	}
+
+	// Changed content yields a new name, the same content the same one
+	changed, _ := generateTestResources(t, "color=green\n")
+	if changed[0].Metadata.Name == configMap.Metadata.Name {
+		t.Error("Expected a new name for changed content")
+	}
+	if changed[2].Metadata.Name != secret.Metadata.Name {
+		t.Error("Expected the same name for unchanged content")
+	}
+}
+
+func TestRewriteGeneratedReferences(t *testing.T) {
+	docs := manifest.Read([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        envFrom:
+        - configMapRef:
+            name: app-config
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: app-secrets
+              key: PASSWORD
+        - name: OTHER
+          valueFrom:
+            configMapKeyRef:
+              name: unrelated
+              key: OTHER
+      volumes:
+      - name: config
+        configMap:
+          name: app-config
+      - name: secrets
+        secret:
+          secretName: app-secrets
+`))
+	rewriteGeneratedReferences(docs, map[generatedName]string{
+		{Kind: "ConfigMap", Name: "app-config"}: "app-config-0123456789",
+		{Kind: "Secret", Name: "app-secrets"}:   "app-secrets-9876543210",
+	})
+
+	output, err := yaml.Marshal(docs[0].Root())
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if !docs[0].Changed ||
+		strings.Count(string(output), "app-config-0123456789") != 2 ||
+		strings.Count(string(output), "app-secrets-9876543210") != 2 ||
+		!strings.Contains(string(output), "name: unrelated") {
+		t.Errorf("Unexpected references:\n%s", output)
+	}
+}
@@ -16,16 +16,21 @@ package deployment
 
 import (
 	"fmt"
-	"helm-ci/deploy/templates"
+	"helm-ci/deploy/semver"
 	"helm-ci/deploy/utils"
 	"os"
-	"path/filepath"
 	"strings"
 )
 
 // HelmDeployer implements Helm-based deployments
 type HelmDeployer struct {
 	Common
+	// repoConfigDir holds the private Helm repositories file and cache of this run
+	repoConfigDir string
+	// repoCreds are the resolved repository credentials, nil if none are configured
+	repoCreds *repoCredentials
+	// promotion is the lockfile entry being promoted, nil for regular deployments
+	promotion *LockEntry
 }
 
 // GetTraefikDashboardArgs returns arguments for Traefik dashboard
@@ -74,80 +79,103 @@ func (d *HelmDeployer) GetRootCAArgs() []string {
 
 // Deploy implements the Helm deployment
 func (d *HelmDeployer) Deploy() error {
-	if err := d.SetupRootCA(); err != nil {
-		return err
-	}
-
 	var args []string
 	args = append(args, "upgrade", "--install", d.Config.ReleaseName)
 
-	// Check if the repository is an OCI registry
-	if strings.HasPrefix(d.Config.Repository, "oci://") {
-		args = append(args, fmt.Sprintf("%s/%s", d.Config.Repository, d.Config.Chart))
-	} else {
-		args = append(args, fmt.Sprintf("%s/%s", d.Config.AppName, d.Config.Chart))
-		// Add helm repo for all apps
-		repoAddCmd := d.Cmd.Command("helm", "repo", "add", d.Config.AppName, d.Config.Repository)
-		if err := d.Cmd.Run(repoAddCmd); err != nil {
-			return utils.NewError("failed to add Helm repository: %v", err)
-		}
+	cleanupRepoConfig, err := d.setupRepoConfig()
+	if err != nil {
+		return err
+	}
+	defer cleanupRepoConfig()
 
-		repoUpdateCmd := d.Cmd.Command("helm", "repo", "update")
-		if err := d.Cmd.Run(repoUpdateCmd); err != nil {
-			return utils.NewError("failed to update Helm repository: %v", err)
-		}
+	chartRef, chartArgs, err := d.chartReference()
+	if err != nil {
+		return err
 	}
 
-	args = append(args, "--namespace", d.Config.Namespace, "--create-namespace")
+	// Resolve version constraints to an exact version
+	version, err := d.resolveChartVersion()
+	if err != nil {
+		return err
+	}
+
+	// With a lockfile the chart is pulled first, so the exact package that is
+	// deployed can be recorded and verified on promotion
+	chartSource := chartRef
+	lock, err := d.loadLockFile()
+	if err != nil {
+		return err
+	}
+	var digest string
+	if lock != nil && !IsLocalChart(d.Config.Chart) {
+		pullDir, err := os.MkdirTemp("", "helm-ci-chart-*")
+		if err != nil {
+			return utils.NewError("failed to create chart download directory: %v", err)
+		}
+		defer os.RemoveAll(pullDir)
 
-	// Process domain template if domains are specified
-	if len(d.Config.Domains) > 0 {
-		domainValuesFile, err := templates.ProcessDomainTemplate(d.Config)
+		chartSource, digest, version, err = d.pullChart(chartRef, chartArgs, version, pullDir)
 		if err != nil {
 			return err
 		}
-		if domainValuesFile != "" {
-			defer os.Remove(domainValuesFile)
-			args = append(args, "--values", domainValuesFile)
+		if err := d.verifyPromotedDigest(digest); err != nil {
+			return err
 		}
 	}
+	args = append(args, chartSource)
+	args = append(args, d.repoConfigArgs()...)
+	args = append(args, chartArgs...)
+
+	args = append(args, "--namespace", d.Config.Namespace, "--create-namespace")
 
-	// Process and add values files with Vault templating
-	commonValuesPattern := filepath.Join(d.Config.ValuesPath, "common.y*ml")
-	matches, err := filepath.Glob(commonValuesPattern)
+	// Merge the generated domain values and the layered values files with
+	// Vault templating into a single values file
+	layers, err := d.loadValuesLayers()
 	if err != nil {
 		return err
 	}
-	if len(matches) > 0 {
-		processedFile, err := d.ProcessValuesFileWithVault(matches[0])
-		if err != nil {
-			return err
-		}
-		if processedFile != matches[0] {
-			defer os.Remove(processedFile)
-		}
-		args = append(args, "--values", processedFile)
+	if err := d.validateValues(layers, chartSource, chartArgs, version); err != nil {
+		return err
+	}
+	valuesFile, err := writeMergedValues(layers)
+	if err != nil {
+		return err
 	}
+	defer os.Remove(valuesFile)
+	args = append(args, "--values", valuesFile)
 
-	stageValuesPattern := filepath.Join(d.Config.ValuesPath, fmt.Sprintf("%s.y*ml", d.Config.Stage))
-	matches, err = filepath.Glob(stageValuesPattern)
+	// Single value overrides take precedence over all values files
+	setArgs, cleanupSetFiles, err := d.setArgs()
 	if err != nil {
 		return err
 	}
-	if len(matches) > 0 {
-		processedFile, err := d.ProcessValuesFileWithVault(matches[0])
-		if err != nil {
-			return err
-		}
-		if processedFile != matches[0] {
-			defer os.Remove(processedFile)
-		}
-		args = append(args, "--values", processedFile)
+	defer cleanupSetFiles()
+	args = append(args, setArgs...)
+
+	// Add version if specified; a pulled chart package already is that version
+	if version != "" && chartSource == chartRef {
+		args = append(args, "--version", version)
 	}
 
-	// Add version if specified
-	if d.Config.Version != "" {
-		args = append(args, "--version", d.Config.Version)
+	d.Summary.Set("Release", d.Config.ReleaseName)
+	d.Summary.Set("Namespace", d.Config.Namespace)
+	d.Summary.Set("Chart", chartRef)
+	if len(layers.files) > 0 {
+		d.Summary.Set("Values files", strings.Join(layers.files, ", "))
+	}
+	if version != "" {
+		d.Summary.Set("Chart version", version)
+	} else {
+		d.Summary.Set("Chart version", "latest")
+	}
+	if semver.IsConstraint(d.Config.Version) {
+		d.Summary.Set("Chart version constraint", d.Config.Version)
+	}
+	if digest != "" {
+		d.Summary.Set("Chart digest", digest)
+	}
+	if d.promotion != nil {
+		d.Summary.Set("Promoted from", d.Config.PromoteFrom)
 	}
 
 	// Add Traefik dashboard args if applicable
@@ -158,6 +186,18 @@ func (d *HelmDeployer) Deploy() error {
 	// Add root CA args
 	args = append(args, d.GetRootCAArgs()...)
 
+	// Label and annotate every rendered resource
+	postRendererArgs, err := d.postRendererArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, postRendererArgs...)
+
+	// Check the rendered chart for APIs the target Kubernetes version deprecates
+	if err := d.checkRenderedAPIs(args); err != nil {
+		return err
+	}
+
 	// Show diff first
 	utils.Green("Showing differences:")
 	diffErr := d.GetDiff(args, true)
@@ -172,15 +212,27 @@ func (d *HelmDeployer) Deploy() error {
 		return diffErr
 	}
 
+	if d.Config.Plan {
+		utils.Green("Plan mode, nothing was deployed")
+		return nil
+	}
+
 	// Check if we should proceed
 	if !utils.ConfirmDeployment(d.Config.DEBUG) {
 		return utils.NewError("Deployment cancelled by user")
 	}
 
 	// Proceed with actual deployment
+	if err := d.SetupRootCA(); err != nil {
+		return err
+	}
 	cmd := d.Cmd.Command("helm", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	return d.Cmd.Run(cmd)
+	if err := d.Cmd.Run(cmd); err != nil {
+		return err
+	}
+
+	return d.recordLockEntry(lock, version, digest)
 }
@@ -0,0 +1,189 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpecPaths locate the pod spec in the workload kinds whose images can be overridden
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerLists are the pod spec fields holding containers
+var containerLists = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// imageOverride replaces the image of containers running the image Name,
+// like the images field of a kustomization
+type imageOverride struct {
+	Name    string
+	NewName string
+	Tag     string
+	Digest  string
+}
+
+// parseImageOverride parses name=registry/app:tag, name=registry/app@digest,
+// name:tag or name@digest
+func parseImageOverride(value string) (imageOverride, error) {
+	name, ref, found := strings.Cut(value, "=")
+	if !found {
+		ref = value
+	}
+	newName, tag, digest := splitImage(ref)
+	if !found {
+		name, newName = newName, ""
+	}
+	override := imageOverride{Name: strings.TrimSpace(name), NewName: newName, Tag: tag, Digest: digest}
+	if override.Name == "" || (override.NewName == "" && tag == "" && digest == "") {
+		return imageOverride{}, utils.NewError("invalid image override %q, expected name=registry/app:tag or name@digest", value)
+	}
+	return override, nil
+}
+
+// splitImage splits an image reference into its name, tag and digest
+func splitImage(image string) (name, tag, digest string) {
+	name = image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+	}
+	// A colon before the last slash separates a registry port, not a tag
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	return name, tag, digest
+}
+
+// apply returns the overridden image and whether the override matches it
+func (o imageOverride) apply(image string) (string, bool) {
+	name, tag, digest := splitImage(image)
+	if name != o.Name {
+		return image, false
+	}
+	if o.NewName != "" {
+		name = o.NewName
+	}
+	switch {
+	case o.Digest != "":
+		return name + "@" + o.Digest, true
+	case o.Tag != "":
+		return name + ":" + o.Tag, true
+	}
+	if tag != "" {
+		name += ":" + tag
+	}
+	if digest != "" {
+		name += "@" + digest
+	}
+	return name, true
+}
+
+// overrideImages applies the --image overrides to the containers of the
+// workloads in the documents and reports every image that changed
+func (d *CustomDeployer) overrideImages(docs []*manifest.Document) error {
+	if len(d.Config.Images) == 0 {
+		return nil
+	}
+	overrides := make([]imageOverride, 0, len(d.Config.Images))
+	for _, value := range d.Config.Images {
+		override, err := parseImageOverride(value)
+		if err != nil {
+			return err
+		}
+		overrides = append(overrides, override)
+	}
+
+	matched := make([]bool, len(overrides))
+	var changes []string
+	for _, doc := range docs {
+		podSpec := findPodSpec(doc)
+		if podSpec == nil {
+			continue
+		}
+		for _, list := range containerLists {
+			containers := findChildByKey(podSpec, list)
+			if containers == nil || containers.Kind != yaml.SequenceNode {
+				continue
+			}
+			for _, container := range containers.Content {
+				image := findChildByKey(container, "image")
+				if image == nil || image.Kind != yaml.ScalarNode {
+					continue
+				}
+				for i, override := range overrides {
+					newImage, ok := override.apply(image.Value)
+					if !ok {
+						continue
+					}
+					matched[i] = true
+					if newImage != image.Value {
+						name := ""
+						if containerName := findChildByKey(container, "name"); containerName != nil {
+							name = containerName.Value
+						}
+						change := fmt.Sprintf("%s/%s %s: %s -> %s", doc.Kind(), resourceName(doc), name, image.Value, newImage)
+						utils.Log.Infof("Image override %s", change)
+						changes = append(changes, change)
+						image.Value = newImage
+						image.Style = 0
+						doc.Changed = true
+					}
+					break
+				}
+			}
+		}
+	}
+
+	for i := range overrides {
+		if !matched[i] {
+			utils.Log.Warningf("Image override %s matches no container", d.Config.Images[i])
+		}
+	}
+	if len(changes) > 0 {
+		d.Summary.Set("Image overrides", strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// findPodSpec returns the pod spec of a workload document, or nil for other kinds
+func findPodSpec(doc *manifest.Document) *yaml.Node {
+	path, ok := podSpecPaths[doc.Kind()]
+	if !ok {
+		return nil
+	}
+	node := doc.Root()
+	for _, key := range path {
+		if node == nil {
+			return nil
+		}
+		node = findChildByKey(node, key)
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return node
+}
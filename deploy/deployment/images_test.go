@@ -0,0 +1,125 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"strings"
+	"testing"
+)
+
+func TestImageOverrideApply(t *testing.T) {
+	tests := []struct {
+		override string
+		image    string
+		expected string
+		match    bool
+	}{
+		{"nginx=registry.example.com/nginx:1.27", "nginx:1.25", "registry.example.com/nginx:1.27", true},
+		{"nginx:1.27", "nginx", "nginx:1.27", true},
+		{"nginx@sha256:abc", "nginx:1.25", "nginx@sha256:abc", true},
+		{"nginx=mirror/nginx", "nginx:1.25", "mirror/nginx:1.25", true},
+		{"registry:5000/app:2", "registry:5000/app:1", "registry:5000/app:2", true},
+		{"nginx:1.27", "mirror/nginx:1.25", "mirror/nginx:1.25", false},
+	}
+
+	for _, tt := range tests {
+		override, err := parseImageOverride(tt.override)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.override, err)
+		}
+		image, match := override.apply(tt.image)
+		if image != tt.expected || match != tt.match {
+			t.Errorf("%q applied to %q = %q, %v, want %q, %v", tt.override, tt.image, image, match, tt.expected, tt.match)
+		}
+	}
+
+	for _, invalid := range []string{"nginx", "=nginx:1.27", ""} {
+		if _, err := parseImageOverride(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestOverrideImages(t *testing.T) {
+	content := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: app:1.0
+      containers:
+      - name: web
+        image: app:1.0
+      - name: proxy
+        image: envoy:1.30
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: app:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  image: app:1.0
+`
+	docs := manifest.Read([]byte(content))
+	deployer := &CustomDeployer{Common: Common{
+		Config:  &config.Config{Images: []string{"app=registry.example.com/app:2.0", "unused:1"}},
+		Summary: &Summary{},
+	}}
+
+	if err := deployer.overrideImages(docs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output, err := manifest.Write(docs)
+	if err != nil {
+		t.Fatalf("Failed to write manifests: %v", err)
+	}
+
+	if strings.Count(string(output), "image: registry.example.com/app:2.0") != 3 {
+		t.Errorf("Expected three containers to be updated, got:\n%s", output)
+	}
+	for _, unchanged := range []string{"image: envoy:1.30", "image: app:1.0"} {
+		if !strings.Contains(string(output), unchanged) {
+			t.Errorf("Expected %q to stay, got:\n%s", unchanged, output)
+		}
+	}
+	changes, _ := deployer.Summary.Get("Image overrides")
+	if !strings.Contains(changes, "CronJob/cleanup cleanup: app:1.0 -> registry.example.com/app:2.0") {
+		t.Errorf("Expected the CronJob change in the summary, got %q", changes)
+	}
+
+	deployer.Config.Images = []string{"app"}
+	if err := deployer.overrideImages(docs); err == nil {
+		t.Error("Expected an error for an invalid override")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// inventoryPrefix names the ConfigMap recording the resources of a release
+const inventoryPrefix = "helm-ci-inventory-"
+
+// inventoryKey is the ConfigMap data key holding the resource list
+const inventoryKey = "resources"
+
+// ResourceID identifies a deployed resource
+type ResourceID struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	Name       string `yaml:"name"`
+}
+
+func (r ResourceID) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// identity returns the resource without the version of its API group, so that
+// apps/v1 and apps/v1beta2 definitions of the same Deployment compare equal;
+// any served version of a resource addresses the same object
+func (r ResourceID) identity() ResourceID {
+	group, _, ok := strings.Cut(r.APIVersion, "/")
+	if !ok {
+		group = ""
+	}
+	r.APIVersion = group
+	return r
+}
+
+// kubectlName returns the resource as TYPE.VERSION.GROUP/NAME for kubectl
+// Core resources have no group and are addressed by their kind only
+func (r ResourceID) kubectlName() string {
+	resource := r.Kind
+	if group, version, ok := strings.Cut(r.APIVersion, "/"); ok {
+		resource += "." + version + "." + group
+	}
+	return resource + "/" + r.Name
+}
+
+// inventoryName returns the name of the release's inventory ConfigMap
+func (d *CustomDeployer) inventoryName() string {
+	return inventoryPrefix + d.Config.ReleaseName
+}
+
+// resourceIDs returns the identities of the resources in the documents
+func (d *CustomDeployer) resourceIDs(docs []*manifest.Document) []ResourceID {
+	var ids []ResourceID
+	for _, doc := range docs {
+		if id, ok := d.resourceID(doc); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// resourceID returns the identity of the resource in a document
+// Documents without a kind or name have none
+func (d *CustomDeployer) resourceID(doc *manifest.Document) (ResourceID, bool) {
+	name := resourceName(doc)
+	if doc.Kind() == "" || name == "" {
+		return ResourceID{}, false
+	}
+	id := ResourceID{APIVersion: doc.APIVersion(), Kind: doc.Kind(), Name: name}
+	if !d.isClusterScoped(id.Kind) {
+		id.Namespace = resourceNamespace(doc)
+		if id.Namespace == "" {
+			id.Namespace = d.Config.Namespace
+		}
+	}
+	return id, true
+}
+
+// resourceNamespace returns metadata.namespace of the resource in a document
+func resourceNamespace(doc *manifest.Document) string {
+	root := doc.Root()
+	if root == nil {
+		return ""
+	}
+	metadata := findChildByKey(root, "metadata")
+	if metadata == nil {
+		return ""
+	}
+	if namespace := findChildByKey(metadata, "namespace"); namespace != nil {
+		return namespace.Value
+	}
+	return ""
+}
+
+// loadInventory reads the resources recorded by the previous deployment
+// A missing inventory ConfigMap yields an empty inventory
+func (d *CustomDeployer) loadInventory() ([]ResourceID, error) {
+	cmd := d.Cmd.Command("kubectl", "get", "configmap", d.inventoryName(),
+		"-n", d.Config.Namespace, "--ignore-not-found", "-o", "jsonpath={.data."+inventoryKey+"}")
+	output, err := d.Cmd.Output(cmd)
+	if err != nil {
+		return nil, utils.NewError("failed to read inventory %s: %v", d.inventoryName(), err)
+	}
+	if strings.TrimSpace(string(output)) == "" {
+		return nil, nil
+	}
+
+	var ids []ResourceID
+	if err := yaml.Unmarshal(output, &ids); err != nil {
+		return nil, utils.NewError("failed to parse inventory %s: %v", d.inventoryName(), err)
+	}
+	return ids, nil
+}
+
+// saveInventory records the deployed resources in the inventory ConfigMap
+func (d *CustomDeployer) saveInventory(ids []ResourceID) error {
+	sorted := append([]ResourceID{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	resources, err := yaml.Marshal(sorted)
+	if err != nil {
+		return utils.NewError("failed to encode inventory: %v", err)
+	}
+
+	labels := map[string]string{ManagedByLabel: ManagedByValue}
+	configMap := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      d.inventoryName(),
+			"namespace": d.Config.Namespace,
+			"labels":    labels,
+		},
+		"data": map[string]string{inventoryKey: string(resources)},
+	}
+	content, err := yaml.Marshal(configMap)
+	if err != nil {
+		return utils.NewError("failed to encode inventory: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "inventory-*.yml")
+	if err != nil {
+		return utils.NewError("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return utils.NewError("failed to write inventory: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return utils.NewError("failed to close temporary file: %v", err)
+	}
+
+	args := append([]string{"apply"}, d.serverSideArgs()...)
+	args = append(args, "-f", tmpFile.Name(), "-n", d.Config.Namespace)
+	cmd := d.Cmd.Command("kubectl", args...)
+	if output, err := d.Cmd.CombinedOutput(cmd); err != nil {
+		return utils.NewError("failed to save inventory %s: %v\n%s", d.inventoryName(), err, output)
+	}
+	return nil
+}
+
+// staleResources returns the inventory entries that are no longer deployed
+// A resource whose apiVersion changed is still deployed
+func staleResources(inventory, current []ResourceID) []ResourceID {
+	deployed := make(map[ResourceID]bool, len(current))
+	for _, id := range current {
+		deployed[id.identity()] = true
+	}
+	var stale []ResourceID
+	for _, id := range inventory {
+		if !deployed[id.identity()] {
+			stale = append(stale, id)
+		}
+	}
+	return stale
+}
+
+// showDeletions prints the resources that will be pruned as part of the diff
+func showDeletions(stale []ResourceID, dryRun bool) {
+	if len(stale) == 0 {
+		return
+	}
+	if dryRun {
+		utils.Green("\nResources removed from the manifests (prune dry-run, not deleted):\n")
+	} else {
+		utils.Green("\nResources removed from the manifests, will be deleted:\n")
+	}
+	lines := make([]string, 0, len(stale))
+	for _, id := range stale {
+		lines = append(lines, "- "+id.String())
+	}
+	fmt.Println(utils.ColorizeKubectlDiff(strings.Join(lines, "\n")))
+}
+
+// prune deletes resources that were removed from the manifests
+// Returns the resources that are still deployed
+func (d *CustomDeployer) prune(stale []ResourceID) ([]ResourceID, error) {
+	if d.Config.PruneDryRun {
+		for _, id := range stale {
+			utils.Log.Infof("Would prune %s (dry-run)", id)
+		}
+		return stale, nil
+	}
+
+	var pruned []string
+	for _, id := range stale {
+		args := []string{"delete", id.kubectlName(), "--ignore-not-found"}
+		if id.Namespace != "" {
+			args = append(args, "-n", id.Namespace)
+		}
+		cmd := d.Cmd.Command("kubectl", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := d.Cmd.Run(cmd); err != nil {
+			return nil, utils.NewError("failed to prune %s: %v", id, err)
+		}
+		pruned = append(pruned, id.String())
+	}
+	if len(pruned) > 0 {
+		d.Summary.Set("Pruned resources", strings.Join(pruned, ", "))
+	}
+	return nil, nil
+}
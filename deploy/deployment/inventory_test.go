@@ -0,0 +1,162 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"strings"
+	"testing"
+)
+
+const testInventory = `- apiVersion: v1
+  kind: ConfigMap
+  namespace: web
+  name: settings
+- apiVersion: apps/v1
+  kind: Deployment
+  namespace: web
+  name: worker
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRole
+  name: worker-reader
+`
+
+func newPruneTestDeployer(t *testing.T, inventory string, dryRun bool) (*CustomDeployer, *MockCommander) {
+	t.Helper()
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		"live/settings.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  key: value\n",
+	})
+
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("kubectl:get:configmap", []byte(inventory), nil)
+	deployer := &CustomDeployer{Common: Common{
+		Config: &config.Config{
+			ValuesPath:  dir,
+			Stage:       "live",
+			Namespace:   "web",
+			ReleaseName: "web",
+			Prune:       true,
+			PruneDryRun: dryRun,
+		},
+		Cmd:     mockCmd,
+		Summary: &Summary{},
+	}}
+	return deployer, mockCmd
+}
+
+func deleteCommands(mockCmd *MockCommander) []string {
+	var deletes []string
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "kubectl" && cmd.Args[0] == "delete" {
+			deletes = append(deletes, strings.Join(cmd.Args, " "))
+		}
+	}
+	return deletes
+}
+
+func TestCustomDeployer_Deploy_PrunesRemovedResources(t *testing.T) {
+	deployer, mockCmd := newPruneTestDeployer(t, testInventory, false)
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+
+	expected := []string{
+		"delete Deployment.v1.apps/worker --ignore-not-found -n web",
+		"delete ClusterRole.v1.rbac.authorization.k8s.io/worker-reader --ignore-not-found",
+	}
+	deletes := deleteCommands(mockCmd)
+	if strings.Join(deletes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected deletes %v, got %v", expected, deletes)
+	}
+	if pruned, _ := deployer.Summary.Get("Pruned resources"); pruned != "Deployment/web/worker, ClusterRole/worker-reader" {
+		t.Errorf("Unexpected pruned resources in summary: %q", pruned)
+	}
+
+	// The inventory is read from and written to the release's ConfigMap
+	var read, saved bool
+	for _, cmd := range mockCmd.Commands {
+		args := strings.Join(cmd.Args, " ")
+		if strings.HasPrefix(args, "get configmap helm-ci-inventory-web -n web --ignore-not-found") {
+			read = true
+		}
+		if cmd.Args[0] == "apply" && strings.Contains(args, "inventory-") {
+			saved = true
+		}
+	}
+	if !read || !saved {
+		t.Errorf("Expected the inventory to be read and saved, got read=%v saved=%v", read, saved)
+	}
+}
+
+func TestCustomDeployer_Deploy_PruneDryRun(t *testing.T) {
+	deployer, mockCmd := newPruneTestDeployer(t, testInventory, true)
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	if deletes := deleteCommands(mockCmd); len(deletes) != 0 {
+		t.Errorf("Expected no deletes in dry-run, got %v", deletes)
+	}
+	if pruned, _ := deployer.Summary.Get("Pruned resources"); pruned != "" {
+		t.Errorf("Expected nothing pruned in dry-run, got %q", pruned)
+	}
+}
+
+func TestCustomDeployer_Deploy_EmptyInventory(t *testing.T) {
+	deployer, mockCmd := newPruneTestDeployer(t, "", false)
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	if deletes := deleteCommands(mockCmd); len(deletes) != 0 {
+		t.Errorf("Expected no deletes without inventory, got %v", deletes)
+	}
+}
+
+func TestStaleResources(t *testing.T) {
+	inventory := []ResourceID{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "web", Name: "settings"},
+		{APIVersion: "v1", Kind: "Service", Namespace: "web", Name: "old"},
+	}
+	current := []ResourceID{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "web", Name: "settings"},
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "web", Name: "new"},
+	}
+	stale := staleResources(inventory, current)
+	if len(stale) != 1 || stale[0].String() != "Service/web/old" || stale[0].kubectlName() != "Service/old" {
+		t.Errorf("Expected Service/web/old to be stale, got %v", stale)
+	}
+}
+
+func TestCustomDeployer_Deploy_APIVersionChangeIsNotPruned(t *testing.T) {
+	deployer, mockCmd := newPruneTestDeployer(t, `- apiVersion: v1
+  kind: ConfigMap
+  namespace: web
+  name: settings
+- apiVersion: autoscaling/v2beta2
+  kind: HorizontalPodAutoscaler
+  namespace: web
+  name: web
+`, false)
+	writeManifests(t, deployer.Config.ValuesPath, map[string]string{
+		"live/hpa.yaml": "apiVersion: autoscaling/v2\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n",
+	})
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	if deletes := deleteCommands(mockCmd); len(deletes) != 0 {
+		t.Errorf("Expected the upgraded HorizontalPodAutoscaler to be kept, got deletes %v", deletes)
+	}
+}
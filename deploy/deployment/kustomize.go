@@ -0,0 +1,70 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/utils"
+	"os"
+	"path/filepath"
+)
+
+// kustomizationFiles are the file names kustomize recognizes in a directory
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// findKustomization returns the directory to build with kustomize: the stage
+// directory if it has a kustomization, otherwise the values path, or "" if neither has one
+func (d *CustomDeployer) findKustomization() string {
+	for _, dir := range []string{filepath.Join(d.Config.ValuesPath, d.Config.Stage), d.Config.ValuesPath} {
+		for _, name := range kustomizationFiles {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+// buildKustomization builds a kustomization with kubectl kustomize, falling back
+// to the kustomize binary, and writes the result to a temporary manifest file
+func (d *CustomDeployer) buildKustomization(dir string) (string, error) {
+	utils.Green("Building kustomization in %s", dir)
+
+	cmd := d.Cmd.Command("kubectl", "kustomize", dir)
+	output, err := d.Cmd.Output(cmd)
+	if err != nil {
+		utils.Log.Warningf("kubectl kustomize failed, trying the kustomize binary: %v", err)
+		cmd = d.Cmd.Command("kustomize", "build", dir)
+		var fallbackErr error
+		output, fallbackErr = d.Cmd.Output(cmd)
+		if fallbackErr != nil {
+			return "", utils.NewError("failed to build kustomization %s: kubectl kustomize: %v, kustomize build: %v", dir, err, fallbackErr)
+		}
+	}
+
+	tmpFile, err := os.CreateTemp("", "kustomize-*.yml")
+	if err != nil {
+		return "", utils.NewError("failed to create temporary file: %v", err)
+	}
+	if _, err := tmpFile.Write(output); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to write kustomization output: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to close temporary file: %v", err)
+	}
+	return tmpFile.Name(), nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testKustomizeOutput = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+
+func TestCustomDeployer_FindKustomization(t *testing.T) {
+	dir := t.TempDir()
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{ValuesPath: dir, Stage: "live"}}}
+	if found := deployer.findKustomization(); found != "" {
+		t.Errorf("Expected no kustomization, got %s", found)
+	}
+
+	writeManifests(t, dir, map[string]string{"kustomization.yaml": "resources: [base]\n"})
+	if found := deployer.findKustomization(); found != dir {
+		t.Errorf("Expected the values path kustomization, got %q", found)
+	}
+
+	writeManifests(t, dir, map[string]string{"live/kustomization.yml": "resources: [../base]\n"})
+	if found := deployer.findKustomization(); found != filepath.Join(dir, "live") {
+		t.Errorf("Expected the stage kustomization, got %q", found)
+	}
+}
+
+func TestCustomDeployer_Deploy_Kustomization(t *testing.T) {
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		"live/kustomization.yaml": "resources: [../base]\n",
+		"live/ignored.yaml":       "apiVersion: v1\nkind: Secret\nmetadata:\n  name: not-globbed\n",
+	})
+
+	for _, tc := range []struct {
+		name     string
+		kubectl  error
+		fallback bool
+	}{
+		{name: "kubectl kustomize"},
+		{name: "kustomize binary", kubectl: errors.New("unknown command"), fallback: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCmd := NewMockCommander()
+			if tc.kubectl != nil {
+				mockCmd.AddResponse("kubectl:kustomize", nil, tc.kubectl)
+				mockCmd.AddResponse("kustomize:build", []byte(testKustomizeOutput), nil)
+			} else {
+				mockCmd.AddResponse("kubectl:kustomize", []byte(testKustomizeOutput), nil)
+			}
+			deployer := &CustomDeployer{Common: Common{
+				Config: &config.Config{ValuesPath: dir, Stage: "live", Namespace: "web"},
+				Cmd:    mockCmd,
+			}}
+
+			if err := deployer.Deploy(); err != nil {
+				t.Fatalf("Deploy failed: %v", err)
+			}
+
+			var built, usedFallback bool
+			applies := 0
+			for _, cmd := range mockCmd.Commands {
+				args := strings.Join(cmd.Args, " ")
+				switch {
+				case cmd.Name == "kubectl" && args == "kustomize "+filepath.Join(dir, "live"):
+					built = true
+				case cmd.Name == "kustomize" && args == "build "+filepath.Join(dir, "live"):
+					usedFallback = true
+				case cmd.Name == "kubectl" && cmd.Args[0] == "apply" && !slices.Contains(cmd.Args, "--dry-run=server"):
+					applies++
+				}
+			}
+			if !built || usedFallback != tc.fallback {
+				t.Errorf("Expected kustomize build with fallback=%v, got built=%v fallback=%v", tc.fallback, built, usedFallback)
+			}
+			if applies != 1 {
+				t.Errorf("Expected the kustomize output to be applied once, got %d applies", applies)
+			}
+		})
+	}
+}
+
+func TestCustomDeployer_Deploy_KustomizationSecretsWithVault(t *testing.T) {
+	server := newVaultTestServer(t, map[string]string{
+		"/v1/secret/data/app": `{"data": {"data": {"PASSWORD": "s3cret"}}}`,
+	})
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{"live/kustomization.yaml": "secretGenerator: []\n"})
+
+	// secretGenerator output is base64 encoded already
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("kubectl:kustomize", []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: web-credentials-7h8k2m
+data:
+  user: YWRtaW4=
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-settings
+data:
+  password: <<vault.app/PASSWORD>>
+`), nil)
+	var applied string
+	mockCmd.OnCommand = func(cmd MockCommand) {
+		if cmd.Name == "kubectl" && cmd.Args[0] == "apply" {
+			for i, arg := range cmd.Args {
+				if arg == "-f" && i+1 < len(cmd.Args) {
+					content, _ := os.ReadFile(cmd.Args[i+1])
+					applied += string(content)
+				}
+			}
+		}
+	}
+	deployer := &CustomDeployer{Common: Common{
+		Config: &config.Config{
+			ValuesPath:     dir,
+			Stage:          "live",
+			Namespace:      "web",
+			VaultURL:       server.URL,
+			VaultBasePath:  "secret",
+			VaultKVVersion: 2,
+		},
+		Cmd: mockCmd,
+	}}
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Deploy failed: %v", err)
+	}
+	if !strings.Contains(applied, "user: YWRtaW4=") {
+		t.Errorf("Expected the kustomize Secret to be applied unchanged, got:\n%s", applied)
+	}
+	if !strings.Contains(applied, "password: s3cret") {
+		t.Errorf("Expected the Vault placeholder to be resolved, got:\n%s", applied)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"helm-ci/deploy/utils"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockEntry records the chart deployed to one stage of an app
+type LockEntry struct {
+	Chart        string `yaml:"chart"`
+	Repository   string `yaml:"repository,omitempty"`
+	Version      string `yaml:"version,omitempty"`
+	Digest       string `yaml:"digest,omitempty"`
+	ValuesCommit string `yaml:"valuesCommit,omitempty"`
+	ValuesPath   string `yaml:"valuesPath,omitempty"`
+	DeployedAt   string `yaml:"deployedAt"`
+}
+
+// LockFile maps app and stage to the chart that was deployed there
+type LockFile struct {
+	Apps map[string]map[string]*LockEntry `yaml:"apps"`
+
+	path string
+}
+
+// LoadLockFile reads a lockfile; a missing file yields an empty lockfile
+func LoadLockFile(path string) (*LockFile, error) {
+	lock := &LockFile{Apps: map[string]map[string]*LockEntry{}, path: path}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, utils.NewError("failed to read lockfile %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(content, lock); err != nil {
+		return nil, utils.NewError("failed to parse lockfile %s: %v", path, err)
+	}
+	if lock.Apps == nil {
+		lock.Apps = map[string]map[string]*LockEntry{}
+	}
+	return lock, nil
+}
+
+// Get returns the entry of an app and stage, or nil if none is recorded
+func (l *LockFile) Get(app, stage string) *LockEntry {
+	return l.Apps[app][stage]
+}
+
+// Set records the entry of an app and stage
+func (l *LockFile) Set(app, stage string, entry *LockEntry) {
+	if l.Apps[app] == nil {
+		l.Apps[app] = map[string]*LockEntry{}
+	}
+	l.Apps[app][stage] = entry
+}
+
+// Save writes the lockfile back to the path it was loaded from
+func (l *LockFile) Save() error {
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return utils.NewError("failed to encode lockfile: %v", err)
+	}
+	if dir := filepath.Dir(l.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return utils.NewError("failed to create lockfile directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(l.path, content, 0644); err != nil {
+		return utils.NewError("failed to write lockfile %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// fileDigest returns the sha256 digest of a file in the form used by Helm repository indexes
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// packagedChartVersion reads the version from the Chart.yaml of a packaged chart
+func packagedChartVersion(file string) (string, error) {
+	content, err := readChartFile(file, "Chart.yaml")
+	if err != nil {
+		return "", err
+	}
+	if content == nil {
+		return "", utils.NewError("no Chart.yaml found in %s", file)
+	}
+	var chart struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(content, &chart); err != nil {
+		return "", utils.NewError("failed to parse Chart.yaml in %s: %v", file, err)
+	}
+	return chart.Version, nil
+}
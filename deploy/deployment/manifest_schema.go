@@ -0,0 +1,315 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/schema"
+	"helm-ci/deploy/utils"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaDirSuffixes are the variants of a version directory in the kubeconform
+// layout, strict schemas reject unknown fields
+var schemaDirSuffixes = []string{"-standalone-strict", "-standalone", ""}
+
+// schemaClient downloads the Kubernetes schemas missing from the cache
+var schemaClient = &http.Client{Timeout: 30 * time.Second}
+
+// defaultSchemaLocation is the cache searched for Kubernetes schemas without --schema-location
+func defaultSchemaLocation() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "helm-ci", "kubernetes-json-schema")
+}
+
+// manifestValidator finds and caches the schemas of the resources in the manifests
+type manifestValidator struct {
+	loader *schema.Loader
+	// versionDirs hold the schemas of the target Kubernetes version
+	versionDirs []string
+	// crdLocations hold CRD schemas as <group>/<kind>_<version>.json
+	crdLocations []string
+	// crds are the schemas of the CRDs in the manifests
+	crds map[string]*schema.Schema
+	// schemas caches the schema of every type, nil if there is none
+	schemas map[string]*schema.Schema
+	// downloadURL is the version directory missing schemas are downloaded
+	// from into downloadDir, empty to stay offline
+	downloadURL string
+	downloadDir string
+}
+
+// newManifestValidator looks up the schema directories of the target version
+// Without --schema-location the user cache is used, and schemas missing from
+// it are downloaded from --schema-url. Returns nil if validation is disabled,
+// no version is given or the cache is empty and downloads are off.
+func (d *CustomDeployer) newManifestValidator() (*manifestValidator, error) {
+	if !d.Config.ValidateManifests {
+		return nil, nil
+	}
+	if d.Config.KubeVersion == "" {
+		utils.Log.Warning("Manifest validation needs --kube-version, skipping manifest validation")
+		return nil, nil
+	}
+	version := "v" + strings.TrimPrefix(d.Config.KubeVersion, "v")
+
+	locations := d.Config.SchemaLocations
+	if len(locations) == 0 {
+		locations = []string{defaultSchemaLocation()}
+	}
+	var versionDirs []string
+	for _, location := range locations {
+		for _, suffix := range schemaDirSuffixes {
+			dir := filepath.Join(location, version+suffix)
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				versionDirs = append(versionDirs, dir)
+			}
+		}
+	}
+
+	var downloadURL, downloadDir string
+	if len(d.Config.SchemaLocations) == 0 && locations[0] != "" && d.Config.SchemaURL != "" {
+		downloadURL = strings.TrimSuffix(d.Config.SchemaURL, "/") + "/" + version + "-standalone-strict/"
+		downloadDir = filepath.Join(locations[0], version+"-standalone-strict")
+		if !slices.Contains(versionDirs, downloadDir) {
+			versionDirs = append(versionDirs, downloadDir)
+		}
+	}
+	if len(versionDirs) == 0 {
+		if len(d.Config.SchemaLocations) == 0 {
+			utils.Log.Warningf("No schemas for Kubernetes %s cached in %s, skipping manifest validation", version, locations[0])
+			return nil, nil
+		}
+		return nil, utils.NewError("no schemas for Kubernetes %s in %s", version, strings.Join(locations, ", "))
+	}
+
+	return &manifestValidator{
+		loader: schema.NewLoader(func(uri string) ([]byte, error) {
+			return os.ReadFile(filepath.FromSlash(uri))
+		}),
+		versionDirs:  versionDirs,
+		crdLocations: d.Config.CRDSchemaLocations,
+		crds:         map[string]*schema.Schema{},
+		schemas:      map[string]*schema.Schema{},
+		downloadURL:  downloadURL,
+		downloadDir:  downloadDir,
+	}, nil
+}
+
+// validateManifests validates every document against the schema of its
+// Kubernetes version or CRD before anything is applied, and reports all
+// violations with the file and document they were found in
+func (d *CustomDeployer) validateManifests(docs []*manifest.Document, origins map[*manifest.Document]documentOrigin) error {
+	validator, err := d.newManifestValidator()
+	if err != nil || validator == nil {
+		return err
+	}
+	if err := validator.addCRDs(docs); err != nil {
+		return err
+	}
+
+	var violations []string
+	skipped := map[string]bool{}
+	for _, doc := range docs {
+		origin := origins[doc]
+		if doc.Err != nil {
+			violations = append(violations, fmt.Sprintf("%s: invalid YAML: %v", origin, doc.Err))
+			continue
+		}
+		root := doc.Root()
+		if root == nil {
+			continue
+		}
+		if doc.APIVersion() == "" || doc.Kind() == "" {
+			violations = append(violations, fmt.Sprintf("%s: apiVersion and kind are required", origin))
+			continue
+		}
+
+		s, err := validator.schema(doc.APIVersion(), doc.Kind())
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			if key := doc.APIVersion() + "/" + doc.Kind(); !skipped[key] {
+				skipped[key] = true
+				utils.Log.Warningf("No schema for %s %s, not validated", doc.APIVersion(), doc.Kind())
+			}
+			continue
+		}
+
+		var value interface{}
+		if err := root.Decode(&value); err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", origin, err))
+			continue
+		}
+		for _, violation := range s.Validate(value) {
+			violations = append(violations, fmt.Sprintf("%s %s/%s: %s", origin, doc.Kind(), resourceName(doc), violation))
+		}
+	}
+
+	if len(violations) > 0 {
+		return utils.NewError("%d schema violation(s) in the manifests:\n  %s", len(violations), strings.Join(violations, "\n  "))
+	}
+	utils.Log.Infof("Manifests are valid for Kubernetes %s", d.Config.KubeVersion)
+	return nil
+}
+
+// addCRDs registers the openAPIV3Schema of every version of the CRDs in the manifests
+func (v *manifestValidator) addCRDs(docs []*manifest.Document) error {
+	for _, doc := range docs {
+		if doc.Kind() != "CustomResourceDefinition" {
+			continue
+		}
+		var crd struct {
+			Spec struct {
+				Group string `yaml:"group"`
+				Names struct {
+					Kind string `yaml:"kind"`
+				} `yaml:"names"`
+				Versions []struct {
+					Name   string `yaml:"name"`
+					Schema struct {
+						OpenAPIV3Schema yaml.Node `yaml:"openAPIV3Schema"`
+					} `yaml:"schema"`
+				} `yaml:"versions"`
+			} `yaml:"spec"`
+		}
+		if err := doc.Root().Decode(&crd); err != nil {
+			return utils.NewError("failed to read CRD %s: %v", resourceName(doc), err)
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Schema.OpenAPIV3Schema.Kind == 0 {
+				continue
+			}
+			content, err := yaml.Marshal(&version.Schema.OpenAPIV3Schema)
+			if err != nil {
+				return utils.NewError("failed to read the schema of CRD %s: %v", resourceName(doc), err)
+			}
+			s, err := schema.Parse(content)
+			if err != nil {
+				return utils.NewError("invalid schema in CRD %s: %v", resourceName(doc), err)
+			}
+			v.crds[crd.Spec.Group+"/"+version.Name+"/"+crd.Spec.Names.Kind] = s
+		}
+	}
+	return nil
+}
+
+// schema returns the schema of a type, nil if there is none
+// Kubernetes schemas come first, then the CRDs in the manifests, then the CRD
+// locations, and last the schemas downloaded into the cache.
+func (v *manifestValidator) schema(apiVersion, kind string) (*schema.Schema, error) {
+	key := apiVersion + "/" + kind
+	if s, ok := v.schemas[key]; ok {
+		return s, nil
+	}
+
+	group, version, found := strings.Cut(apiVersion, "/")
+	if !found {
+		group, version = "", apiVersion
+	}
+	// kubeconform names schemas <kind>-<first group label>-<version>.json
+	name := strings.ToLower(kind)
+	if group != "" {
+		name += "-" + strings.ToLower(strings.Split(group, ".")[0])
+	}
+	name += "-" + strings.ToLower(version) + ".json"
+
+	var candidates []string
+	for _, dir := range v.versionDirs {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	s, err := v.loadFirst(key, candidates)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		s = v.crds[key]
+	}
+	if s == nil && group != "" {
+		candidates = nil
+		for _, location := range v.crdLocations {
+			candidates = append(candidates, filepath.Join(location, group, strings.ToLower(kind)+"_"+version+".json"))
+		}
+		if s, err = v.loadFirst(key, candidates); err != nil {
+			return nil, err
+		}
+	}
+	if s == nil && v.downloadURL != "" {
+		if s, err = v.download(key, name); err != nil {
+			return nil, err
+		}
+	}
+	v.schemas[key] = s
+	return s, nil
+}
+
+// loadFirst loads the first of the schema files that exists, nil if none does
+func (v *manifestValidator) loadFirst(key string, files []string) (*schema.Schema, error) {
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		s, err := v.loader.Load(filepath.ToSlash(file))
+		if err != nil {
+			return nil, utils.NewError("failed to load schema for %s: %v", key, err)
+		}
+		return s, nil
+	}
+	return nil, nil
+}
+
+// download fetches a schema missing from the cache and stores it there
+// Returns nil if the schema set has no schema of that name.
+func (v *manifestValidator) download(key, name string) (*schema.Schema, error) {
+	url := v.downloadURL + name
+	utils.Log.Debugf("Downloading schema for %s from %s", key, url)
+	resp, err := schemaClient.Get(url)
+	if err != nil {
+		return nil, utils.NewError("failed to download schema for %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.NewError("failed to download schema for %s: %s returned %s", key, url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, utils.NewError("failed to download schema for %s: %v", key, err)
+	}
+
+	if err := os.MkdirAll(v.downloadDir, 0755); err != nil {
+		return nil, utils.NewError("failed to create schema cache %s: %v", v.downloadDir, err)
+	}
+	file := filepath.Join(v.downloadDir, name)
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		return nil, utils.NewError("failed to cache schema for %s: %v", key, err)
+	}
+	return v.loadFirst(key, []string{file})
+}
@@ -0,0 +1,223 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSchemas is a small schema set in the kubeconform layout, the Deployment
+// referencing the shared definitions like the non-standalone schemas do
+var testSchemas = map[string]string{
+	"v1.29.0/deployment-apps-v1.json": `{"$ref": "_definitions.json#/definitions/io.k8s.api.apps.v1.Deployment"}`,
+	"v1.29.0/_definitions.json": `{"definitions": {
+  "io.k8s.api.apps.v1.Deployment": {
+    "type": "object",
+    "additionalProperties": false,
+    "properties": {
+      "apiVersion": {"type": "string"},
+      "kind": {"type": "string"},
+      "metadata": {"type": "object"},
+      "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}
+    }
+  },
+  "io.k8s.api.apps.v1.DeploymentSpec": {
+    "type": "object",
+    "additionalProperties": false,
+    "properties": {"replicas": {"type": "integer"}}
+  }
+}}`,
+	"v1.29.0-standalone-strict/service-v1.json":         `{"type": "object", "required": ["spec"]}`,
+	"crds/monitoring.coreos.com/servicemonitor_v1.json": `{"type": "object", "required": ["spec"]}`,
+}
+
+const testSchemaManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: "3"
+  replica: 3
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  names:
+    kind: Certificate
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [secretName]
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: web
+spec:
+  dnsNames: [example.com]
+---
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: web
+---
+apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: web
+`
+
+func newManifestSchemaTestDeployer(t *testing.T) (*CustomDeployer, []*manifest.Document, map[*manifest.Document]documentOrigin) {
+	t.Helper()
+	dir := t.TempDir()
+	writeManifests(t, dir, testSchemas)
+
+	docs := manifest.Read([]byte(testSchemaManifests))
+	origins := map[*manifest.Document]documentOrigin{}
+	for i, doc := range docs {
+		origins[doc] = documentOrigin{file: "live/app.yaml", index: i + 1}
+	}
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{
+		Namespace:          "web",
+		KubeVersion:        "1.29.0",
+		ValidateManifests:  true,
+		SchemaLocations:    []string{dir},
+		CRDSchemaLocations: []string{dir + "/crds"},
+	}}}
+	return deployer, docs, origins
+}
+
+func TestValidateManifests(t *testing.T) {
+	deployer, docs, origins := newManifestSchemaTestDeployer(t)
+
+	err := deployer.validateManifests(docs, origins)
+	if err == nil {
+		t.Fatal("Expected schema violations")
+	}
+	expected := []string{
+		"5 schema violation(s)",
+		"live/app.yaml (document 1) Deployment/web: spec.replica: unknown key, additional properties are not allowed",
+		"live/app.yaml (document 1) Deployment/web: spec.replicas: expected integer, got string",
+		"live/app.yaml (document 2) Service/web: spec is required",
+		"live/app.yaml (document 4) Certificate/web: spec: secretName is required",
+		"live/app.yaml (document 5) ServiceMonitor/web: spec is required",
+	}
+	for _, message := range expected {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected %q in the error, got:\n%v", message, err)
+		}
+	}
+	if strings.Contains(err.Error(), "Unknown") {
+		t.Errorf("Expected kinds without schema to be skipped, got:\n%v", err)
+	}
+}
+
+func TestValidateManifests_Disabled(t *testing.T) {
+	deployer, docs, origins := newManifestSchemaTestDeployer(t)
+	deployer.Config.ValidateManifests = false
+	if err := deployer.validateManifests(docs, origins); err != nil {
+		t.Errorf("Expected no validation, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	origLogOut := utils.Log.Out
+	utils.Log.SetOutput(&buf)
+	deployer.Config.ValidateManifests = true
+	deployer.Config.KubeVersion = ""
+	err := deployer.validateManifests(docs, origins)
+	utils.Log.SetOutput(origLogOut)
+	if err != nil || !strings.Contains(buf.String(), "Manifest validation needs --kube-version") {
+		t.Errorf("Expected a warning without --kube-version, got %v: %s", err, buf.String())
+	}
+
+	deployer.Config.KubeVersion = "v1.30.0"
+	if err := deployer.validateManifests(docs, origins); err == nil || !strings.Contains(err.Error(), "no schemas for Kubernetes v1.30.0") {
+		t.Errorf("Expected an error for a version without schemas, got %v", err)
+	}
+}
+
+func TestValidateManifests_DownloadsMissingSchemas(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path != "/v1.29.0-standalone-strict/service-v1.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"type": "object", "required": ["spec"]}`))
+	}))
+	defer server.Close()
+
+	docs := manifest.Read([]byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\napiVersion: example.com/v1\nkind: Unknown\nmetadata:\n  name: web\n"))
+	origins := map[*manifest.Document]documentOrigin{}
+	for i, doc := range docs {
+		origins[doc] = documentOrigin{file: "live/app.yaml", index: i + 1}
+	}
+	deployer := &CustomDeployer{Common: Common{Config: &config.Config{
+		Namespace:         "web",
+		KubeVersion:       "1.29.0",
+		ValidateManifests: true,
+		SchemaURL:         server.URL,
+	}}}
+
+	err := deployer.validateManifests(docs, origins)
+	if err == nil || !strings.Contains(err.Error(), "Service/web: spec is required") {
+		t.Fatalf("Expected a violation from the downloaded schema, got %v", err)
+	}
+	expected := []string{"/v1.29.0-standalone-strict/service-v1.json", "/v1.29.0-standalone-strict/unknown-example-v1.json"}
+	if !slices.Equal(requests, expected) {
+		t.Errorf("Expected requests %v, got %v", expected, requests)
+	}
+	if _, err := os.Stat(filepath.Join(defaultSchemaLocation(), "v1.29.0-standalone-strict", "service-v1.json")); err != nil {
+		t.Errorf("Expected the schema in the cache: %v", err)
+	}
+
+	// The next run reads the schema from the cache
+	requests = nil
+	err = deployer.validateManifests(docs, origins)
+	if err == nil || !strings.Contains(err.Error(), "Service/web: spec is required") {
+		t.Fatalf("Expected a violation from the cached schema, got %v", err)
+	}
+	if slices.Contains(requests, "/v1.29.0-standalone-strict/service-v1.json") {
+		t.Errorf("Expected the cached schema to be used, got requests %v", requests)
+	}
+}
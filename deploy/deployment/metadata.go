@@ -0,0 +1,265 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/utils"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Standard metadata set on every deployed resource
+const (
+	ManagedByLabel       = "app.kubernetes.io/managed-by"
+	ManagedByValue       = "helm-ci"
+	StageLabel           = "helm-ci/stage"
+	PRLabel              = "helm-ci/pr"
+	GitSHAAnnotation     = "helm-ci/git-sha"
+	RunURLAnnotation     = "helm-ci/run-url"
+	DeployedAtAnnotation = "helm-ci/deployed-at"
+)
+
+// Metadata holds labels and annotations to add to resources
+type Metadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// StandardMetadata returns the standard labels and annotations for a deployment
+// The managed-by label is only set on custom deployments, as Helm sets it to
+// Helm on the resources of its releases
+func StandardMetadata(cfg *config.Config, deployedAt time.Time) Metadata {
+	m := Metadata{
+		Labels:      map[string]string{},
+		Annotations: map[string]string{DeployedAtAnnotation: deployedAt.UTC().Format(time.RFC3339)},
+	}
+	if cfg.Custom {
+		m.Labels[ManagedByLabel] = ManagedByValue
+	}
+	if cfg.Stage != "" {
+		m.Labels[StageLabel] = labelValue(cfg.Stage)
+	}
+	if cfg.PRNumber != "" {
+		m.Labels[PRLabel] = labelValue(cfg.PRNumber)
+	}
+	if cfg.GitSHA != "" {
+		m.Annotations[GitSHAAnnotation] = cfg.GitSHA
+	}
+	if cfg.RunURL != "" {
+		m.Annotations[RunURLAnnotation] = cfg.RunURL
+	}
+	return m
+}
+
+// standardMetadata returns the standard metadata, or nil if it is disabled
+func (c *Common) standardMetadata() *Metadata {
+	if !c.Config.StandardMetadata {
+		return nil
+	}
+	if c.StartedAt.IsZero() {
+		c.StartedAt = time.Now()
+	}
+	m := StandardMetadata(c.Config, c.StartedAt)
+	return &m
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// labelValue turns a string into a valid label value: at most 63 characters
+// of alphanumerics, '-', '_' and '.', beginning and ending with an alphanumeric
+func labelValue(s string) string {
+	s = invalidLabelChars.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "._-")
+}
+
+// Apply adds the labels and annotations to metadata of the resource in a YAML document
+// Returns true if the document was updated
+func (m Metadata) Apply(doc *yaml.Node) bool {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return false
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode || findChildByKey(root, "kind") == nil {
+		return false
+	}
+
+	metadataNode := findOrAddMapping(root, "metadata")
+	if metadataNode == nil {
+		return false
+	}
+	labelsUpdated := setMappingValues(findOrAddMapping(metadataNode, "labels"), m.Labels)
+	annotationsUpdated := setMappingValues(findOrAddMapping(metadataNode, "annotations"), m.Annotations)
+	return labelsUpdated || annotationsUpdated
+}
+
+// Args returns the flags that pass the metadata to the post-render command
+func (m Metadata) Args() []string {
+	var args []string
+	for _, key := range sortedKeys(m.Labels) {
+		args = append(args, "--label="+key+"="+m.Labels[key])
+	}
+	for _, key := range sortedKeys(m.Annotations) {
+		args = append(args, "--annotation="+key+"="+m.Annotations[key])
+	}
+	return args
+}
+
+// findOrAddMapping returns the mapping under a key, adding an empty one if the key
+// is missing or null. Returns nil if the key holds something else.
+func findOrAddMapping(mappingNode *yaml.Node, key string) *yaml.Node {
+	child := findChildByKey(mappingNode, key)
+	if child != nil && child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+		*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		return child
+	}
+	if child != nil {
+		if child.Kind != yaml.MappingNode {
+			return nil
+		}
+		return child
+	}
+
+	child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mappingNode.Content = append(mappingNode.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+	return child
+}
+
+// setMappingValues sets string values in a mapping node in sorted key order
+// Returns true if any value was added or changed
+func setMappingValues(mappingNode *yaml.Node, entries map[string]string) bool {
+	if mappingNode == nil {
+		return false
+	}
+	updated := false
+	for _, key := range sortedKeys(entries) {
+		value := entries[key]
+		if existing := findChildByKey(mappingNode, key); existing != nil {
+			if existing.Kind == yaml.ScalarNode && existing.Value == value {
+				continue
+			}
+			*existing = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+		} else {
+			mappingNode.Content = append(mappingNode.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+		}
+		updated = true
+	}
+	return updated
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// postRendererArgs returns the helm flags that run this binary as post-renderer
+// adding the standard metadata to every rendered resource
+func (d *HelmDeployer) postRendererArgs() ([]string, error) {
+	m := d.standardMetadata()
+	if m == nil {
+		return nil, nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, utils.NewError("failed to locate the helm-ci binary for the post-renderer: %v", err)
+	}
+
+	args := []string{"--post-renderer", executable, "--post-renderer-args", config.PostRenderCommand}
+	for _, arg := range m.Args() {
+		args = append(args, "--post-renderer-args", arg)
+	}
+	return args, nil
+}
+
+// PostRender implements the post-render command: it reads the manifests
+// rendered by helm, adds the labels and annotations given as --label and
+// --annotation flags to every resource and writes the result
+func PostRender(args []string, in io.Reader, out io.Writer) error {
+	m := Metadata{Labels: map[string]string{}, Annotations: map[string]string{}}
+	flags := flag.NewFlagSet(config.PostRenderCommand, flag.ContinueOnError)
+	flags.Var(keyValueFlag(m.Labels), "label", "Label key=value to add (repeatable)")
+	flags.Var(keyValueFlag(m.Annotations), "annotation", "Annotation key=value to add (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return utils.NewError("failed to read rendered manifests: %v", err)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return utils.NewError("failed to parse rendered manifests: %v", err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		m.Apply(&doc)
+		if err := enc.Encode(&doc); err != nil {
+			return utils.NewError("failed to encode manifest: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return utils.NewError("failed to encode manifests: %v", err)
+	}
+
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// keyValueFlag is a repeatable flag.Value collecting key=value pairs
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	return ""
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[key] = val
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"bytes"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var testDeployedAt = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestStandardMetadata(t *testing.T) {
+	m := StandardMetadata(&config.Config{
+		Custom:   true,
+		Stage:    "dev",
+		PRNumber: "42",
+		GitSHA:   "abc123",
+		RunURL:   "https://github.com/org/repo/actions/runs/7",
+	}, testDeployedAt)
+
+	expectedLabels := map[string]string{
+		"app.kubernetes.io/managed-by": "helm-ci",
+		"helm-ci/stage":                "dev",
+		"helm-ci/pr":                   "42",
+	}
+	expectedAnnotations := map[string]string{
+		"helm-ci/git-sha":     "abc123",
+		"helm-ci/run-url":     "https://github.com/org/repo/actions/runs/7",
+		"helm-ci/deployed-at": "2025-03-01T12:00:00Z",
+	}
+	for key, value := range expectedLabels {
+		if m.Labels[key] != value {
+			t.Errorf("Expected label %s=%s, got %q", key, value, m.Labels[key])
+		}
+	}
+	for key, value := range expectedAnnotations {
+		if m.Annotations[key] != value {
+			t.Errorf("Expected annotation %s=%s, got %q", key, value, m.Annotations[key])
+		}
+	}
+
+	// Without PR, SHA and run URL only the known values are set
+	m = StandardMetadata(&config.Config{Stage: "live"}, testDeployedAt)
+	if _, ok := m.Labels[PRLabel]; ok {
+		t.Error("Expected no PR label without a PR number")
+	}
+	if len(m.Annotations) != 1 {
+		t.Errorf("Expected only the deploy timestamp annotation, got %v", m.Annotations)
+	}
+
+	// Helm deployments keep the managed-by label set by Helm
+	if _, ok := m.Labels[ManagedByLabel]; ok {
+		t.Error("Expected no managed-by label outside of custom deployments")
+	}
+}
+
+func TestMetadata_Apply(t *testing.T) {
+	m := Metadata{
+		Labels:      map[string]string{"app.kubernetes.io/managed-by": "helm-ci", "helm-ci/stage": "dev"},
+		Annotations: map[string]string{"helm-ci/git-sha": "abc123"},
+	}
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{
+			name:     "existing labels are kept",
+			content:  "kind: Service\nmetadata:\n  name: svc\n  labels:\n    app: web\n    app.kubernetes.io/managed-by: Helm\n",
+			expected: true,
+		},
+		{
+			name:     "missing metadata is added",
+			content:  "kind: ConfigMap\ndata:\n  key: value\n",
+			expected: true,
+		},
+		{
+			name:     "null labels are replaced",
+			content:  "kind: ConfigMap\nmetadata:\n  name: cm\n  labels:\n  annotations: ~\n",
+			expected: true,
+		},
+		{
+			name:     "already labelled",
+			content:  "kind: ConfigMap\nmetadata:\n  labels:\n    app.kubernetes.io/managed-by: helm-ci\n    helm-ci/stage: dev\n  annotations:\n    helm-ci/git-sha: abc123\n",
+			expected: false,
+		},
+		{
+			name:     "not a resource",
+			content:  "foo: bar\n",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.content), &doc); err != nil {
+				t.Fatalf("Failed to parse document: %v", err)
+			}
+			if updated := m.Apply(&doc); updated != tc.expected {
+				t.Fatalf("Expected updated=%v, got %v", tc.expected, updated)
+			}
+			if !tc.expected {
+				return
+			}
+
+			var resource struct {
+				Metadata struct {
+					Labels      map[string]string `yaml:"labels"`
+					Annotations map[string]string `yaml:"annotations"`
+				} `yaml:"metadata"`
+			}
+			if err := doc.Decode(&resource); err != nil {
+				t.Fatalf("Failed to decode document: %v", err)
+			}
+			for key, value := range m.Labels {
+				if resource.Metadata.Labels[key] != value {
+					t.Errorf("Expected label %s=%s, got %v", key, value, resource.Metadata.Labels)
+				}
+			}
+			if resource.Metadata.Annotations["helm-ci/git-sha"] != "abc123" {
+				t.Errorf("Expected git SHA annotation, got %v", resource.Metadata.Annotations)
+			}
+			if strings.Contains(tc.content, "app: web") && resource.Metadata.Labels["app"] != "web" {
+				t.Errorf("Expected existing label app=web to be kept, got %v", resource.Metadata.Labels)
+			}
+		})
+	}
+}
+
+func TestPostRender(t *testing.T) {
+	in := "---\n# Source: chart/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n---\n# Source: chart/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  labels:\n    app: web\n"
+
+	var out bytes.Buffer
+	err := PostRender([]string{"--label=helm-ci/stage=dev", "--annotation=helm-ci/git-sha=abc123"}, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dec := yaml.NewDecoder(&out)
+	count := 0
+	for {
+		var resource struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Labels      map[string]string `yaml:"labels"`
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := dec.Decode(&resource); err != nil {
+			break
+		}
+		count++
+		if resource.Metadata.Labels["helm-ci/stage"] != "dev" || resource.Metadata.Annotations["helm-ci/git-sha"] != "abc123" {
+			t.Errorf("Expected metadata on %s, got %+v", resource.Kind, resource.Metadata)
+		}
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 documents, got %d:\n%s", count, out.String())
+	}
+
+	if err := PostRender([]string{"--label=novalue"}, strings.NewReader(in), &out); err == nil {
+		t.Error("Expected an error for a label without value")
+	}
+}
+
+func TestHelmDeployer_Deploy_PostRenderer(t *testing.T) {
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{Stage: "dev", StandardMetadata: true, GitSHA: "abc123"})
+	deployer.StartedAt = testDeployedAt
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	last, _ := mockCmd.GetLastCommand()
+	args := strings.Join(last.Args, " ")
+	for _, expected := range []string{
+		"--post-renderer-args post-render",
+		"--post-renderer-args --label=helm-ci/stage=dev",
+		"--post-renderer-args --annotation=helm-ci/deployed-at=2025-03-01T12:00:00Z",
+		"--post-renderer-args --annotation=helm-ci/git-sha=abc123",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("Expected %q in helm args, got %s", expected, args)
+		}
+	}
+	if strings.Contains(args, "app.kubernetes.io/managed-by") {
+		t.Errorf("Expected the managed-by label set by Helm to be kept, got %s", args)
+	}
+	if !slices.Contains(last.Args, "--post-renderer") {
+		t.Errorf("Expected --post-renderer in helm args, got %s", args)
+	}
+}
+
+func TestCustomDeployer_UpdateNamespaces_AddsStandardMetadata(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "configmap.yaml")
+	content := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: test-namespace\ndata:\n  key: value\n"
+	if err := os.WriteFile(manifest, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	deployer := &CustomDeployer{Common: Common{
+		Config:    &config.Config{Custom: true, Namespace: "test-namespace", Stage: "live", StandardMetadata: true},
+		StartedAt: testDeployedAt,
+	}}
+	result, err := deployer.updateNamespaces(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result == manifest {
+		t.Fatal("Expected a new manifest with the standard metadata")
+	}
+	defer os.Remove(result)
+
+	updated, err := os.ReadFile(result)
+	if err != nil {
+		t.Fatalf("Failed to read result: %v", err)
+	}
+	for _, expected := range []string{"app.kubernetes.io/managed-by: helm-ci", "helm-ci/stage: live", "helm-ci/deployed-at: \"2025-03-01T12:00:00Z\""} {
+		if !strings.Contains(string(updated), expected) {
+			t.Errorf("Expected %q in manifest, got:\n%s", expected, updated)
+		}
+	}
+}
+
+func TestCustomDeployer_GetDiff_IgnoresDeployedAt(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "configmap.yaml")
+	content := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: test-namespace\ndata:\n  key: value\n"
+	if err := os.WriteFile(manifest, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	// The live object carries the deploy time of the previous run
+	previous := &CustomDeployer{Common: Common{
+		Config:    &config.Config{Custom: true, Namespace: "test-namespace", Stage: "live", StandardMetadata: true},
+		StartedAt: testDeployedAt.Add(-24 * time.Hour),
+	}}
+	live, err := previous.updateNamespaces(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(live)
+	liveYAML, _ := os.ReadFile(live)
+
+	mockCmd := NewMockCommander()
+	deployer := &CustomDeployer{Common: Common{
+		Config:    &config.Config{Custom: true, Namespace: "test-namespace", Stage: "live", StandardMetadata: true, DiffIgnoreDefaults: true},
+		Cmd:       mockCmd,
+		StartedAt: testDeployedAt,
+	}}
+	proposed, err := deployer.updateNamespaces(manifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(proposed)
+	proposedYAML, _ := os.ReadFile(proposed)
+
+	mockCmd.AddResponse("kubectl:get", liveYAML, nil)
+	mockCmd.AddResponse("kubectl:apply", proposedYAML, nil)
+
+	var buf bytes.Buffer
+	origLogOut := utils.Log.Out
+	utils.Log.SetOutput(&buf)
+	defer utils.Log.SetOutput(origLogOut)
+
+	if err := deployer.GetDiff([]string{proposed}, false); err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "0 to change, 0 to remove, 1 unchanged") {
+		t.Errorf("Expected a new deploy time alone to leave the resource unchanged, got: %s", buf.String())
+	}
+}
@@ -31,6 +31,9 @@ type MockCommander struct {
 
 	// Default response if no specific response is found
 	DefaultResponse MockResponse
+
+	// OnCommand is called for every command, e.g. to inspect the files it reads
+	OnCommand func(MockCommand)
 }
 
 // MockCommand represents a command that was executed
@@ -53,6 +56,9 @@ func (m *MockCommander) Command(name string, args ...string) *exec.Cmd {
 		Args: args,
 	}
 	m.Commands = append(m.Commands, cmd)
+	if m.OnCommand != nil {
+		m.OnCommand(cmd)
+	}
 
 	// Return a real command but we'll intercept the execution
 	return exec.Command("echo", "")
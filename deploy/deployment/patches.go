@@ -0,0 +1,458 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/manifest"
+	"helm-ci/deploy/utils"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// patchesDir is the directory below a stage holding patches for the common manifests
+const patchesDir = "patches"
+
+// mergeKeys identify list items in strategic-merge patches, in order of precedence,
+// e.g. volumeMounts by mountPath, container ports by containerPort and env by name
+var mergeKeys = []string{"mountPath", "containerPort", "port", "name"}
+
+// manifestPatch is a strategic-merge or RFC 6902 JSON patch for one resource
+type manifestPatch struct {
+	file string
+	kind string
+	name string
+	// merge is the strategic-merge patch, ops the JSON patch operations
+	merge   *yaml.Node
+	ops     []jsonPatchOp
+	applied bool
+}
+
+// jsonPatchOp is one RFC 6902 operation
+type jsonPatchOp struct {
+	Op    string    `yaml:"op"`
+	Path  string    `yaml:"path"`
+	From  string    `yaml:"from"`
+	Value yaml.Node `yaml:"value"`
+}
+
+// jsonPatchFile is the format of JSON patches: a target and its operations
+type jsonPatchFile struct {
+	Target struct {
+		Kind string `yaml:"kind"`
+		Name string `yaml:"name"`
+	} `yaml:"target"`
+	Patch []jsonPatchOp `yaml:"patch"`
+}
+
+func (p *manifestPatch) String() string {
+	return fmt.Sprintf("%s (%s/%s)", p.file, p.kind, p.name)
+}
+
+// loadPatches reads the patches in <ValuesPath>/<stage>/patches after template
+// and Vault processing. A document with target and patch keys is a JSON patch;
+// any other document is a strategic-merge patch identified by kind and metadata.name.
+func (d *CustomDeployer) loadPatches() ([]*manifestPatch, error) {
+	files, err := filepath.Glob(filepath.Join(d.Config.ValuesPath, d.Config.Stage, patchesDir, "*.y*ml"))
+	if err != nil {
+		return nil, utils.NewError("failed to glob patches: %v", err)
+	}
+	sort.Strings(files)
+
+	var patches []*manifestPatch
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, utils.NewError("failed to read patch %s: %v", file, err)
+		}
+		processed, err := d.processContent(file, content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range manifest.Read([]byte(processed)) {
+			if doc.Err != nil {
+				return nil, utils.NewError("failed to parse patch %s: %v", file, doc.Err)
+			}
+			root := doc.Root()
+			if root == nil {
+				continue
+			}
+
+			if findChildByKey(root, "target") != nil && findChildByKey(root, "patch") != nil {
+				var jsonPatch jsonPatchFile
+				if err := root.Decode(&jsonPatch); err != nil {
+					return nil, utils.NewError("failed to parse JSON patch %s: %v", file, err)
+				}
+				if jsonPatch.Target.Kind == "" || jsonPatch.Target.Name == "" {
+					return nil, utils.NewError("JSON patch %s needs target.kind and target.name", file)
+				}
+				patches = append(patches, &manifestPatch{
+					file: file,
+					kind: jsonPatch.Target.Kind,
+					name: jsonPatch.Target.Name,
+					ops:  jsonPatch.Patch,
+				})
+				continue
+			}
+
+			name := resourceName(doc)
+			if doc.Kind() == "" || name == "" {
+				return nil, utils.NewError("strategic-merge patch %s needs kind and metadata.name", file)
+			}
+			patches = append(patches, &manifestPatch{file: file, kind: doc.Kind(), name: name, merge: root})
+		}
+	}
+	return patches, nil
+}
+
+// applyPatches applies the patches targeting resources in a manifest file
+// Returns the original file if no patch applies, otherwise a temporary file
+func applyPatches(manifestFile string, patches []*manifestPatch) (string, error) {
+	if len(patches) == 0 {
+		return manifestFile, nil
+	}
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return "", utils.NewError("failed to read manifest file %s: %v", manifestFile, err)
+	}
+
+	documents := manifest.Read(content)
+	for _, doc := range documents {
+		root := doc.Root()
+		if root == nil {
+			continue
+		}
+		for _, patch := range patches {
+			if doc.Kind() != patch.kind || resourceName(doc) != patch.name {
+				continue
+			}
+			if patch.merge != nil {
+				strategicMerge(root, patch.merge)
+			} else if err := applyJSONPatch(root, patch.ops); err != nil {
+				return "", utils.NewError("failed to apply patch %s: %v", patch, err)
+			}
+			utils.Log.Infof("Applied patch %s to %s/%s", patch.file, patch.kind, patch.name)
+			patch.applied = true
+			doc.Changed = true
+		}
+	}
+
+	if !manifest.Changed(documents) {
+		return manifestFile, nil
+	}
+	return writeManifestFile(documents)
+}
+
+// unappliedPatches returns an error naming the patches whose target was not found
+func unappliedPatches(patches []*manifestPatch) error {
+	var missing []string
+	for _, patch := range patches {
+		if !patch.applied {
+			missing = append(missing, patch.String())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return utils.NewError("patch target not found in the common manifests: %s", strings.Join(missing, ", "))
+}
+
+// strategicMerge merges a patch mapping into a resource mapping: maps are merged
+// recursively, null deletes a key, lists of maps are merged by their merge key
+// with "$patch: delete" removing an item, and all other values are replaced
+func strategicMerge(dst, patch *yaml.Node) {
+	if directive := findChildByKey(patch, "$patch"); directive != nil && directive.Value == "replace" {
+		*dst = *withoutDirectives(patch)
+		return
+	}
+
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		key, value := patch.Content[i], patch.Content[i+1]
+		if key.Value == "$patch" {
+			continue
+		}
+
+		index := mappingIndex(dst, key.Value)
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			if index >= 0 {
+				dst.Content = append(dst.Content[:index], dst.Content[index+2:]...)
+			}
+			continue
+		}
+		if index < 0 {
+			dst.Content = append(dst.Content, key, withoutDirectives(value))
+			continue
+		}
+
+		existing := dst.Content[index+1]
+		switch {
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			strategicMerge(existing, value)
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			mergeList(existing, value)
+		default:
+			dst.Content[index+1] = withoutDirectives(value)
+		}
+	}
+}
+
+// mergeList merges list items by merge key; lists without one are replaced
+func mergeList(dst, patch *yaml.Node) {
+	key := listMergeKey(patch)
+	if key == "" {
+		*dst = *withoutDirectives(patch)
+		return
+	}
+
+	for _, item := range patch.Content {
+		keyValue := findChildByKey(item, key)
+		index := -1
+		for i, existing := range dst.Content {
+			if other := findChildByKey(existing, key); other != nil && other.Value == keyValue.Value {
+				index = i
+				break
+			}
+		}
+
+		directive := findChildByKey(item, "$patch")
+		switch {
+		case directive != nil && directive.Value == "delete":
+			if index >= 0 {
+				dst.Content = append(dst.Content[:index], dst.Content[index+1:]...)
+			}
+		case index >= 0:
+			strategicMerge(dst.Content[index], item)
+		default:
+			dst.Content = append(dst.Content, withoutDirectives(item))
+		}
+	}
+}
+
+// listMergeKey returns the merge key shared by every item of a patch list, or ""
+func listMergeKey(list *yaml.Node) string {
+	if len(list.Content) == 0 {
+		return ""
+	}
+	for _, key := range mergeKeys {
+		shared := true
+		for _, item := range list.Content {
+			if item.Kind != yaml.MappingNode || findChildByKey(item, key) == nil {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			return key
+		}
+	}
+	return ""
+}
+
+// withoutDirectives returns a copy of a node without $patch keys
+func withoutDirectives(node *yaml.Node) *yaml.Node {
+	out := *node
+	out.Content = nil
+	for i := 0; i < len(node.Content); i++ {
+		if node.Kind == yaml.MappingNode && i+1 < len(node.Content) {
+			if node.Content[i].Value != "$patch" {
+				out.Content = append(out.Content, node.Content[i], withoutDirectives(node.Content[i+1]))
+			}
+			i++
+			continue
+		}
+		out.Content = append(out.Content, withoutDirectives(node.Content[i]))
+	}
+	return &out
+}
+
+// mappingIndex returns the index of a key in a mapping node, or -1
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyJSONPatch applies RFC 6902 operations to a resource
+func applyJSONPatch(root *yaml.Node, ops []jsonPatchOp) error {
+	for _, op := range ops {
+		var err error
+		switch op.Op {
+		case "add":
+			err = pointerAdd(root, op.Path, copyNode(&op.Value))
+		case "remove":
+			_, err = pointerRemove(root, op.Path)
+		case "replace":
+			var value *yaml.Node
+			if value, err = pointerGet(root, op.Path); err == nil {
+				*value = *copyNode(&op.Value)
+			}
+		case "move":
+			var value *yaml.Node
+			if value, err = pointerRemove(root, op.From); err == nil {
+				err = pointerAdd(root, op.Path, value)
+			}
+		case "copy":
+			var value *yaml.Node
+			if value, err = pointerGet(root, op.From); err == nil {
+				err = pointerAdd(root, op.Path, copyNode(value))
+			}
+		case "test":
+			var value *yaml.Node
+			if value, err = pointerGet(root, op.Path); err == nil && !nodesEqual(value, &op.Value) {
+				err = fmt.Errorf("value at %s does not match", op.Path)
+			}
+		default:
+			err = fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", op.Op, op.Path, err)
+		}
+	}
+	return nil
+}
+
+// splitPointer splits a JSON pointer into unescaped tokens
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerParent resolves all but the last token of a pointer
+func pointerParent(root *yaml.Node, pointer string) (*yaml.Node, string, error) {
+	tokens, err := splitPointer(pointer)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", fmt.Errorf("the document root cannot be patched")
+	}
+	node := root
+	for _, token := range tokens[:len(tokens)-1] {
+		if node, err = pointerChild(node, token); err != nil {
+			return nil, "", err
+		}
+	}
+	return node, tokens[len(tokens)-1], nil
+}
+
+func pointerChild(node *yaml.Node, token string) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if index := mappingIndex(node, token); index >= 0 {
+			return node.Content[index+1], nil
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], nil
+		}
+	}
+	return nil, fmt.Errorf("path not found at %q", token)
+}
+
+func pointerGet(root *yaml.Node, pointer string) (*yaml.Node, error) {
+	parent, token, err := pointerParent(root, pointer)
+	if err != nil {
+		return nil, err
+	}
+	return pointerChild(parent, token)
+}
+
+func pointerAdd(root *yaml.Node, pointer string, value *yaml.Node) error {
+	parent, token, err := pointerParent(root, pointer)
+	if err != nil {
+		return err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if index := mappingIndex(parent, token); index >= 0 {
+			parent.Content[index+1] = value
+		} else {
+			parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}, value)
+		}
+		return nil
+	case yaml.SequenceNode:
+		if token == "-" {
+			parent.Content = append(parent.Content, value)
+			return nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(parent.Content) {
+			return fmt.Errorf("invalid list index %q", token)
+		}
+		parent.Content = append(parent.Content[:i], append([]*yaml.Node{value}, parent.Content[i:]...)...)
+		return nil
+	}
+	return fmt.Errorf("cannot add to a scalar")
+}
+
+func pointerRemove(root *yaml.Node, pointer string) (*yaml.Node, error) {
+	parent, token, err := pointerParent(root, pointer)
+	if err != nil {
+		return nil, err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if index := mappingIndex(parent, token); index >= 0 {
+			value := parent.Content[index+1]
+			parent.Content = append(parent.Content[:index], parent.Content[index+2:]...)
+			return value, nil
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(parent.Content) {
+			value := parent.Content[i]
+			parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("path not found at %q", token)
+}
+
+// copyNode returns a deep copy of a node
+func copyNode(node *yaml.Node) *yaml.Node {
+	out := *node
+	out.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		out.Content[i] = copyNode(child)
+	}
+	return &out
+}
+
+// nodesEqual compares the values of two nodes
+func nodesEqual(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testPatchDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+        env:
+        - name: LOG_LEVEL
+          value: debug
+        - name: DEBUG
+          value: "true"
+        volumeMounts:
+        - name: data
+          mountPath: /data
+      - name: sidecar
+        image: busybox
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+    targetPort: 8080
+`
+
+type patchedDeployment struct {
+	Spec struct {
+		Replicas int `yaml:"replicas"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Name         string              `yaml:"name"`
+					Image        string              `yaml:"image"`
+					Env          []map[string]string `yaml:"env"`
+					VolumeMounts []map[string]string `yaml:"volumeMounts"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+func newPatchTestDeployer(t *testing.T, patches map[string]string) (*CustomDeployer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{"common/web.yaml": testPatchDeployment}
+	for name, content := range patches {
+		files[filepath.Join("live", patchesDir, name)] = content
+	}
+	writeManifests(t, dir, files)
+	return &CustomDeployer{Common: Common{
+		Config: &config.Config{ValuesPath: dir, Stage: "live", Namespace: "web"},
+		Cmd:    NewMockCommander(),
+	}}, filepath.Join(dir, "common", "web.yaml")
+}
+
+func patchedDocuments(t *testing.T, file string) (patchedDeployment, map[string]interface{}) {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read patched manifest: %v", err)
+	}
+	dec := yaml.NewDecoder(strings.NewReader(string(content)))
+	var deployment patchedDeployment
+	var service map[string]interface{}
+	if err := dec.Decode(&deployment); err != nil {
+		t.Fatalf("Failed to decode deployment: %v", err)
+	}
+	if err := dec.Decode(&service); err != nil {
+		t.Fatalf("Failed to decode service: %v", err)
+	}
+	return deployment, service
+}
+
+func TestApplyPatches_StrategicMerge(t *testing.T) {
+	deployer, manifestFile := newPatchTestDeployer(t, map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.27
+        env:
+        - name: LOG_LEVEL
+          value: info
+        - name: DEBUG
+          $patch: delete
+        volumeMounts:
+        - name: cache
+          mountPath: /data
+      - name: sidecar
+        $patch: delete
+`,
+	})
+
+	patches, err := deployer.loadPatches()
+	if err != nil {
+		t.Fatalf("Failed to load patches: %v", err)
+	}
+	patched, err := applyPatches(manifestFile, patches)
+	if err != nil {
+		t.Fatalf("Failed to apply patches: %v", err)
+	}
+	defer os.Remove(patched)
+	if err := unappliedPatches(patches); err != nil {
+		t.Errorf("Expected every patch to apply: %v", err)
+	}
+
+	deployment, _ := patchedDocuments(t, patched)
+	if deployment.Spec.Replicas != 3 {
+		t.Errorf("Expected 3 replicas, got %d", deployment.Spec.Replicas)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) != 1 || containers[0].Image != "nginx:1.27" {
+		t.Fatalf("Expected the web container with the new image only, got %+v", containers)
+	}
+	if expected := []map[string]string{{"name": "LOG_LEVEL", "value": "info"}}; !reflect.DeepEqual(containers[0].Env, expected) {
+		t.Errorf("Expected env %v, got %v", expected, containers[0].Env)
+	}
+	if expected := []map[string]string{{"name": "cache", "mountPath": "/data"}}; !reflect.DeepEqual(containers[0].VolumeMounts, expected) {
+		t.Errorf("Expected volume mounts merged by mountPath %v, got %v", expected, containers[0].VolumeMounts)
+	}
+}
+
+func TestApplyPatches_JSONPatch(t *testing.T) {
+	deployer, manifestFile := newPatchTestDeployer(t, map[string]string{
+		"service.yaml": `target:
+  kind: Service
+  name: web
+patch:
+- op: replace
+  path: /spec/ports/0/port
+  value: 443
+- op: add
+  path: /spec/type
+  value: LoadBalancer
+- op: add
+  path: /metadata/annotations
+  value:
+    example.com/tls: "true"
+- op: test
+  path: /spec/ports/0/targetPort
+  value: 8080
+`,
+	})
+
+	patches, err := deployer.loadPatches()
+	if err != nil {
+		t.Fatalf("Failed to load patches: %v", err)
+	}
+	patched, err := applyPatches(manifestFile, patches)
+	if err != nil {
+		t.Fatalf("Failed to apply patches: %v", err)
+	}
+	defer os.Remove(patched)
+
+	_, service := patchedDocuments(t, patched)
+	spec := service["spec"].(map[string]interface{})
+	if spec["type"] != "LoadBalancer" || spec["ports"].([]interface{})[0].(map[string]interface{})["port"] != 443 {
+		t.Errorf("Unexpected patched service spec: %v", spec)
+	}
+	annotations := service["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if annotations["example.com/tls"] != "true" {
+		t.Errorf("Expected the annotation to be added, got %v", annotations)
+	}
+
+	// A failing test operation stops the patch
+	patches[0].ops = []jsonPatchOp{{Op: "remove", Path: "/spec/missing"}}
+	if _, err := applyPatches(manifestFile, patches); err == nil {
+		t.Error("Expected an error for a missing path")
+	}
+}
+
+func TestCustomDeployer_Deploy_PatchTargetNotFound(t *testing.T) {
+	deployer, _ := newPatchTestDeployer(t, map[string]string{
+		"typo.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: wbe\nspec:\n  replicas: 3\n",
+	})
+
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "Deployment/wbe") {
+		t.Errorf("Expected an error naming the missing target, got %v", err)
+	}
+}
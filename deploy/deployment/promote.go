@@ -0,0 +1,222 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"helm-ci/deploy/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Promote deploys the exact chart and values commit recorded for the source
+// stage (--from) to the configured stage
+func (d *HelmDeployer) Promote() error {
+	if d.Config.LockFile == "" {
+		return utils.NewError("--lockfile is required to promote")
+	}
+	if d.Config.PromoteFrom == d.Config.Stage {
+		return utils.NewError("cannot promote stage %s to itself", d.Config.Stage)
+	}
+
+	lock, err := LoadLockFile(d.Config.LockFile)
+	if err != nil {
+		return err
+	}
+	entry := lock.Get(d.Config.AppName, d.Config.PromoteFrom)
+	if entry == nil {
+		return utils.NewError("no lockfile entry for %s in stage %s", d.Config.AppName, d.Config.PromoteFrom)
+	}
+	utils.Log.Infof("Promoting %s %s (%s) from %s to %s", entry.Chart, entry.Version, entry.Digest, d.Config.PromoteFrom, d.Config.Stage)
+
+	d.Config.Chart = entry.Chart
+	d.Config.Repository = entry.Repository
+	d.Config.Version = entry.Version
+
+	if entry.ValuesCommit != "" {
+		paths := []string{entry.ValuesPath}
+		if IsLocalChart(entry.Chart) {
+			paths = append(paths, entry.Chart)
+		}
+
+		dir, err := os.MkdirTemp("", "helm-ci-promote-*")
+		if err != nil {
+			return utils.NewError("failed to create promotion directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, p := range paths {
+			if err := d.extractAtCommit(entry.ValuesCommit, p, dir); err != nil {
+				return err
+			}
+		}
+		d.Config.ValuesPath = filepath.Join(dir, entry.ValuesPath)
+		if IsLocalChart(entry.Chart) {
+			d.Config.Chart = filepath.Join(dir, entry.Chart)
+		}
+		d.Config.GitSHA = entry.ValuesCommit
+	} else {
+		utils.Log.Warningf("No values commit recorded for %s in stage %s, using the current values", d.Config.AppName, d.Config.PromoteFrom)
+	}
+
+	d.promotion = entry
+	return d.Deploy()
+}
+
+// extractAtCommit writes the files below a repository path as of a commit into dir
+func (d *HelmDeployer) extractAtCommit(commit, repoPath, dir string) error {
+	if filepath.IsAbs(repoPath) {
+		return utils.NewError("cannot read %s at commit %s: path must be relative to the repository", repoPath, commit)
+	}
+	repoPath = filepath.ToSlash(filepath.Clean(repoPath))
+
+	// The tree-ish commit:./path is resolved relative to the working directory
+	cmd := d.Cmd.Command("git", "archive", "--format=tar", commit+":./"+repoPath)
+	output, err := d.Cmd.Output(cmd)
+	if err != nil {
+		return utils.NewError("failed to read %s at commit %s: %v", repoPath, commit, err)
+	}
+
+	target := filepath.Join(dir, repoPath)
+	tr := tar.NewReader(bytes.NewReader(output))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return utils.NewError("failed to unpack %s at commit %s: %v", repoPath, commit, err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) || filepath.IsAbs(name) {
+			return utils.NewError("invalid path %s in archive of %s", header.Name, repoPath)
+		}
+		dest := filepath.Join(target, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(dest, content, 0644); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// loadLockFile loads the configured lockfile, or returns nil if none is configured
+func (d *HelmDeployer) loadLockFile() (*LockFile, error) {
+	if d.Config.LockFile == "" {
+		return nil, nil
+	}
+	return LoadLockFile(d.Config.LockFile)
+}
+
+// pullChart downloads the chart package into dir and returns its path, digest and version
+func (d *HelmDeployer) pullChart(chartRef string, chartArgs []string, version, dir string) (string, string, string, error) {
+	pullArgs := []string{"pull", chartRef, "--destination", dir}
+	if version != "" {
+		pullArgs = append(pullArgs, "--version", version)
+	}
+	pullArgs = append(pullArgs, d.repoConfigArgs()...)
+	pullArgs = append(pullArgs, chartArgs...)
+
+	cmd := d.Cmd.Command("helm", pullArgs...)
+	cmd.Stderr = os.Stderr
+	if err := d.Cmd.Run(cmd); err != nil {
+		return "", "", "", utils.NewError("failed to pull chart %s: %v", chartRef, err)
+	}
+
+	packages, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil || len(packages) != 1 {
+		return "", "", "", utils.NewError("expected one chart package after pulling %s, found %d", chartRef, len(packages))
+	}
+
+	digest, err := fileDigest(packages[0])
+	if err != nil {
+		return "", "", "", utils.NewError("failed to compute digest of %s: %v", packages[0], err)
+	}
+	if version == "" {
+		if version, err = packagedChartVersion(packages[0]); err != nil {
+			return "", "", "", utils.NewError("failed to read version of %s: %v", packages[0], err)
+		}
+	}
+
+	utils.Log.Infof("Pulled chart %s %s (%s)", chartRef, version, digest)
+	return packages[0], digest, version, nil
+}
+
+// verifyPromotedDigest refuses a promotion when the repository now serves a
+// different package than the one deployed to the source stage
+func (d *HelmDeployer) verifyPromotedDigest(digest string) error {
+	if d.promotion == nil || d.promotion.Digest == "" {
+		return nil
+	}
+	if digest != d.promotion.Digest {
+		return utils.NewError("refusing to promote %s %s: repository digest %s does not match %s deployed to %s",
+			d.promotion.Chart, d.promotion.Version, digest, d.promotion.Digest, d.Config.PromoteFrom)
+	}
+	return nil
+}
+
+// recordLockEntry stores the deployed chart for this app and stage in the lockfile
+func (d *HelmDeployer) recordLockEntry(lock *LockFile, version, digest string) error {
+	if lock == nil {
+		return nil
+	}
+
+	entry := &LockEntry{
+		Chart:        d.Config.Chart,
+		Repository:   d.Config.Repository,
+		Version:      version,
+		Digest:       digest,
+		ValuesCommit: d.Config.GitSHA,
+		ValuesPath:   d.Config.ValuesPath,
+		DeployedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if d.promotion != nil {
+		// Keep the repository paths instead of the temporary checkout
+		entry.Chart = d.promotion.Chart
+		entry.ValuesPath = d.promotion.ValuesPath
+	}
+	if IsLocalChart(entry.Chart) {
+		entry.Repository = ""
+	}
+	if entry.ValuesCommit == "" {
+		utils.Log.Warning("No git commit known (--git-sha), a promotion will use the values at that time")
+	}
+
+	lock.Set(d.Config.AppName, d.Config.Stage, entry)
+	if err := lock.Save(); err != nil {
+		return err
+	}
+	utils.Log.Infof("Recorded %s %s for %s in %s", entry.Chart, entry.Version, d.Config.Stage, d.Config.LockFile)
+	return nil
+}
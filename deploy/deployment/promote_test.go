@@ -0,0 +1,234 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"helm-ci/deploy/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pullingCommander writes a chart package into the destination of helm pull
+type pullingCommander struct {
+	*MockCommander
+	t       *testing.T
+	version string
+}
+
+func (c *pullingCommander) Command(name string, args ...string) *exec.Cmd {
+	if name == "helm" && len(args) > 0 && args[0] == "pull" {
+		for i := range args {
+			if args[i] == "--destination" && i+1 < len(args) {
+				writeChartPackage(c.t, filepath.Join(args[i+1], "test-chart-"+c.version+".tgz"), c.version)
+			}
+		}
+	}
+	return c.MockCommander.Command(name, args...)
+}
+
+func writeChartPackage(t *testing.T, file, version string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	chartYAML := []byte("apiVersion: v2\nname: test-chart\nversion: " + version + "\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "test-chart/Chart.yaml", Mode: 0644, Size: int64(len(chartYAML))}); err != nil {
+		t.Fatalf("Failed to write tar header: %v", err)
+	}
+	tw.Write(chartYAML)
+	tw.Close()
+	gz.Close()
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write chart package: %v", err)
+	}
+}
+
+func newLockTestDeployer(t *testing.T, cfg *config.Config, version string) (*HelmDeployer, *MockCommander) {
+	deployer, mockCmd := newAuthTestDeployer(cfg)
+	deployer.Cmd = &pullingCommander{MockCommander: mockCmd, t: t, version: version}
+	deployer.Summary = &Summary{}
+	return deployer, mockCmd
+}
+
+func TestLockFile_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "helm-ci.lock")
+
+	lock, err := LoadLockFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading missing lockfile: %v", err)
+	}
+	if lock.Get("app", "dev") != nil {
+		t.Error("Expected no entry in an empty lockfile")
+	}
+
+	lock.Set("app", "dev", &LockEntry{Chart: "nginx", Version: "1.2.3", Digest: "sha256:abc"})
+	if err := lock.Save(); err != nil {
+		t.Fatalf("Failed to save lockfile: %v", err)
+	}
+
+	loaded, err := LoadLockFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	entry := loaded.Get("app", "dev")
+	if entry == nil || entry.Version != "1.2.3" || entry.Digest != "sha256:abc" {
+		t.Errorf("Unexpected entry after reload: %+v", entry)
+	}
+}
+
+func TestHelmDeployer_Deploy_RecordsLockEntry(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "helm-ci.lock")
+	deployer, mockCmd := newLockTestDeployer(t, &config.Config{
+		Repository: "https://charts.example.com",
+		Stage:      "dev",
+		ValuesPath: "helm/values",
+		LockFile:   lockPath,
+		GitSHA:     "abc123",
+	}, "1.4.2")
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lock, err := LoadLockFile(lockPath)
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	entry := lock.Get("test-app", "dev")
+	if entry == nil {
+		t.Fatal("Expected a lockfile entry for test-app/dev")
+	}
+	if entry.Version != "1.4.2" || !strings.HasPrefix(entry.Digest, "sha256:") || entry.ValuesCommit != "abc123" {
+		t.Errorf("Unexpected lockfile entry: %+v", entry)
+	}
+
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && cmd.Args[0] == "upgrade" && !strings.HasSuffix(cmd.Args[3], "test-chart-1.4.2.tgz") {
+			t.Errorf("Expected the pulled package to be deployed, got %s", cmd.Args[3])
+		}
+	}
+}
+
+func TestHelmDeployer_Promote_RefusesDigestMismatch(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "helm-ci.lock")
+	lock, _ := LoadLockFile(lockPath)
+	lock.Set("test-app", "dev", &LockEntry{
+		Chart:      "test-chart",
+		Repository: "https://charts.example.com",
+		Version:    "1.4.2",
+		Digest:     "sha256:0000",
+	})
+	if err := lock.Save(); err != nil {
+		t.Fatalf("Failed to save lockfile: %v", err)
+	}
+
+	deployer, mockCmd := newLockTestDeployer(t, &config.Config{
+		Stage:       "live",
+		PromoteFrom: "dev",
+		LockFile:    lockPath,
+	}, "1.4.2")
+
+	err := deployer.Promote()
+	if err == nil || !strings.Contains(err.Error(), "refusing to promote") {
+		t.Fatalf("Expected digest mismatch error, got %v", err)
+	}
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && cmd.Args[0] == "upgrade" {
+			t.Error("Expected no upgrade after a digest mismatch")
+		}
+	}
+}
+
+func TestHelmDeployer_Promote_UsesLockedChartAndValues(t *testing.T) {
+	// Compute the digest of the package the repository serves
+	pkgDir := t.TempDir()
+	writeChartPackage(t, filepath.Join(pkgDir, "chart.tgz"), "1.4.2")
+	digest, err := fileDigest(filepath.Join(pkgDir, "chart.tgz"))
+	if err != nil {
+		t.Fatalf("Failed to compute digest: %v", err)
+	}
+
+	lockPath := filepath.Join(t.TempDir(), "helm-ci.lock")
+	lock, _ := LoadLockFile(lockPath)
+	lock.Set("test-app", "dev", &LockEntry{
+		Chart:        "test-chart",
+		Repository:   "https://charts.example.com",
+		Version:      "1.4.2",
+		Digest:       digest,
+		ValuesCommit: "abc123",
+		ValuesPath:   "helm/values",
+	})
+	if err := lock.Save(); err != nil {
+		t.Fatalf("Failed to save lockfile: %v", err)
+	}
+
+	// Values as of the locked commit
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	liveValues := []byte("replicas: 3\n")
+	tw.WriteHeader(&tar.Header{Name: "live.yaml", Mode: 0644, Size: int64(len(liveValues)), Typeflag: tar.TypeReg})
+	tw.Write(liveValues)
+	tw.Close()
+
+	deployer, mockCmd := newLockTestDeployer(t, &config.Config{
+		Chart:       "other-chart",
+		Version:     "9.9.9",
+		Stage:       "live",
+		PromoteFrom: "dev",
+		LockFile:    lockPath,
+		ValuesPath:  "helm/values",
+	}, "1.4.2")
+	mockCmd.AddResponse("git:archive:--format=tar:abc123:./helm/values", archive.Bytes(), nil)
+
+	if err := deployer.Promote(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var pulled, upgraded bool
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name != "helm" {
+			continue
+		}
+		joined := strings.Join(cmd.Args, " ")
+		switch cmd.Args[0] {
+		case "pull":
+			pulled = true
+			if !strings.Contains(joined, "/test-chart") || !strings.Contains(joined, "--version 1.4.2") {
+				t.Errorf("Expected the locked chart version to be pulled, got %v", cmd.Args)
+			}
+		case "upgrade":
+			upgraded = true
+		}
+	}
+	if !pulled || !upgraded {
+		t.Errorf("Expected pull and upgrade, got pulled=%v upgraded=%v", pulled, upgraded)
+	}
+
+	if files, _ := deployer.Summary.Get("Values files"); !strings.HasSuffix(files, filepath.Join("helm", "values", "live.yaml")) {
+		t.Errorf("Expected values from the locked commit, got %q", files)
+	}
+
+	reloaded, _ := LoadLockFile(lockPath)
+	entry := reloaded.Get("test-app", "live")
+	if entry == nil || entry.Digest != digest || entry.ValuesCommit != "abc123" || entry.ValuesPath != "helm/values" {
+		t.Errorf("Unexpected live lockfile entry: %+v", entry)
+	}
+}
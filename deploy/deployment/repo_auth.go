@@ -0,0 +1,90 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/utils"
+	"path/filepath"
+	"strings"
+)
+
+// repoCredentials holds the resolved credentials for a chart repository or registry
+type repoCredentials struct {
+	username string
+	password string
+	// token is set when a bearer token was configured instead of a password
+	token string
+}
+
+// repoCredentials resolves the configured repository credentials, including
+// Vault placeholders. Returns nil if no credentials are configured.
+func (d *HelmDeployer) repoCredentials() (*repoCredentials, error) {
+	if d.Config.RepoPassword == "" && d.Config.RepoToken == "" {
+		return nil, nil
+	}
+
+	username, err := d.ResolvePlaceholders(d.Config.RepoUsername)
+	if err != nil {
+		return nil, utils.NewError("failed to resolve repository username: %v", err)
+	}
+	password, err := d.ResolvePlaceholders(d.Config.RepoPassword)
+	if err != nil {
+		return nil, utils.NewError("failed to resolve repository password: %v", err)
+	}
+	token, err := d.ResolvePlaceholders(d.Config.RepoToken)
+	if err != nil {
+		return nil, utils.NewError("failed to resolve repository token: %v", err)
+	}
+
+	if username == "" {
+		return nil, utils.NewError("--repo-username is required when a repository password or token is set")
+	}
+
+	creds := &repoCredentials{username: username, password: password, token: token}
+	if password == "" {
+		// Helm only speaks basic auth to repositories and registries, so the
+		// token is sent as the password, which token based registries accept
+		creds.password = token
+	}
+	return creds, nil
+}
+
+// registryLogin logs into the OCI registry of the configured repository using a
+// private registry config, and returns the flags that make helm use it
+func (d *HelmDeployer) registryLogin(creds *repoCredentials) ([]string, error) {
+	host := strings.TrimPrefix(d.Config.Repository, "oci://")
+	if idx := strings.Index(host, "/"); idx >= 0 {
+		host = host[:idx]
+	}
+
+	var registryArgs []string
+	if d.repoConfigDir != "" {
+		registryArgs = []string{"--registry-config", filepath.Join(d.repoConfigDir, "registry.json")}
+	}
+
+	utils.Log.Infof("Logging into OCI registry %s", host)
+	loginArgs := append([]string{"registry", "login", host, "--username", creds.username, "--password-stdin"}, registryArgs...)
+	if d.Config.RepoCAFile != "" {
+		loginArgs = append(loginArgs, "--ca-file", d.Config.RepoCAFile)
+	}
+
+	cmd := d.Cmd.Command("helm", loginArgs...)
+	cmd.Stdin = strings.NewReader(creds.password)
+	if err := d.Cmd.Run(cmd); err != nil {
+		return nil, utils.NewError("failed to log into OCI registry %s: %v", host, err)
+	}
+
+	return registryArgs, nil
+}
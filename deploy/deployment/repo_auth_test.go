@@ -0,0 +1,155 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"strings"
+	"testing"
+)
+
+func newAuthTestDeployer(cfg *config.Config) (*HelmDeployer, *MockCommander) {
+	mockCmd := NewMockCommander()
+	mockCmd.AddResponse("helm:get:manifest", []byte(""), errors.New("release not found"))
+
+	cfg.AppName = "test-app"
+	cfg.Chart = "test-chart"
+	cfg.ReleaseName = "test-release"
+	cfg.Namespace = "test-namespace"
+
+	return &HelmDeployer{
+		Common: Common{
+			Config: cfg,
+			Cmd:    mockCmd,
+		},
+	}, mockCmd
+}
+
+func assertNoSecretInCommands(t *testing.T, mockCmd *MockCommander, secret string) {
+	t.Helper()
+	for _, cmd := range mockCmd.Commands {
+		if strings.Contains(strings.Join(cmd.Args, " "), secret) {
+			t.Errorf("Secret leaked into command line: %s %v", cmd.Name, cmd.Args)
+		}
+	}
+}
+
+func TestHelmDeployer_Deploy_HTTPRepoCredentials(t *testing.T) {
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{
+		Repository:   "https://charts.example.com",
+		RepoUsername: "ci-user",
+		RepoPassword: "super-secret",
+		RepoCAFile:   "/etc/ssl/repo-ca.crt",
+	})
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := false
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && len(cmd.Args) > 1 && cmd.Args[0] == "repo" && cmd.Args[1] == "add" {
+			found = true
+			args := strings.Join(cmd.Args, " ")
+			for _, expected := range []string{"--username ci-user", "--password-stdin", "--ca-file /etc/ssl/repo-ca.crt"} {
+				if !strings.Contains(args, expected) {
+					t.Errorf("Expected helm repo add to contain %q, got: %v", expected, cmd.Args)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("Expected helm repo add to be called")
+	}
+
+	assertNoSecretInCommands(t, mockCmd, "super-secret")
+}
+
+func TestHelmDeployer_Deploy_OCIRegistryLogin(t *testing.T) {
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{
+		Repository:   "oci://registry.example.com/charts",
+		RepoUsername: "ci-user",
+		RepoToken:    "registry-token",
+	})
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	loginFound := false
+	registryConfig := ""
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name != "helm" || len(cmd.Args) < 3 {
+			continue
+		}
+		if cmd.Args[0] == "registry" && cmd.Args[1] == "login" {
+			loginFound = true
+			if cmd.Args[2] != "registry.example.com" {
+				t.Errorf("Expected login to registry.example.com, got %s", cmd.Args[2])
+			}
+			for i, arg := range cmd.Args {
+				if arg == "--registry-config" && i+1 < len(cmd.Args) {
+					registryConfig = cmd.Args[i+1]
+				}
+			}
+		}
+		if cmd.Args[0] == "upgrade" && (registryConfig == "" || !strings.Contains(strings.Join(cmd.Args, " "), registryConfig)) {
+			t.Errorf("Expected helm upgrade to use the private registry config, got: %v", cmd.Args)
+		}
+	}
+
+	if !loginFound {
+		t.Fatalf("Expected helm registry login to be called")
+	}
+	assertNoSecretInCommands(t, mockCmd, "registry-token")
+}
+
+func TestHelmDeployer_RepoCredentials_Errors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        *config.Config
+		expectedError string
+	}{
+		{
+			name:          "missing username",
+			config:        &config.Config{RepoToken: "token"},
+			expectedError: "--repo-username is required",
+		},
+		{
+			name:          "vault placeholder without vault",
+			config:        &config.Config{RepoUsername: "ci-user", RepoPassword: "<<vault.helm/repo/PASSWORD>>"},
+			expectedError: "no Vault URL is configured",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deployer := &HelmDeployer{Common: Common{Config: tc.config, Cmd: NewMockCommander()}}
+			_, err := deployer.repoCredentials()
+			if err == nil {
+				t.Fatalf("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("Expected error to contain %q, got: %v", tc.expectedError, err)
+			}
+		})
+	}
+
+	deployer := &HelmDeployer{Common: Common{Config: &config.Config{}, Cmd: NewMockCommander()}}
+	if creds, err := deployer.repoCredentials(); err != nil || creds != nil {
+		t.Errorf("Expected no credentials without configuration, got %+v (err: %v)", creds, err)
+	}
+}
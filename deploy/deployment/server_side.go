@@ -0,0 +1,107 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/utils"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// fieldConflict is a field owned by another manager that server-side apply refused to take over
+type fieldConflict struct {
+	Manager string
+	Field   string
+}
+
+var (
+	// conflictManager matches `conflict with "manager"` and `conflicts with "manager" using apps/v1:`
+	conflictManager = regexp.MustCompile(`conflicts? with "([^"]+)"(?: using [^:\s]+)?:\s*(.*)$`)
+	// conflictField matches the `- .spec.replicas` lines listing the fields of a manager
+	conflictField = regexp.MustCompile(`^\s*-\s+(\..+)$`)
+)
+
+// serverSideArgs returns the kubectl apply and diff flags for server-side apply
+func (c *Common) serverSideArgs() []string {
+	if !c.Config.ServerSide {
+		return nil
+	}
+	args := []string{"--server-side", "--field-manager=" + c.Config.FieldManager}
+	if slices.Contains(c.Config.ForceConflicts, c.Config.Stage) {
+		args = append(args, "--force-conflicts")
+	}
+	return args
+}
+
+// applyManifest applies a manifest file, reporting server-side apply conflicts
+// with the manager and field involved
+func (d *CustomDeployer) applyManifest(file string) error {
+	args := append([]string{"apply"}, d.serverSideArgs()...)
+	args = append(args, "-f", file, "-n", d.Config.Namespace)
+	cmd := d.Cmd.Command("kubectl", args...)
+
+	output, err := d.Cmd.CombinedOutput(cmd)
+	fmt.Print(utils.MaskSecrets(string(output)))
+	if err == nil {
+		return nil
+	}
+
+	if err := d.conflictError(string(output)); err != nil {
+		return err
+	}
+	return utils.NewError("failed to apply manifests: %v", err)
+}
+
+// conflictError reports the server-side apply conflicts in the kubectl output,
+// returning nil when there are none
+func (c *Common) conflictError(output string) error {
+	conflicts := parseApplyConflicts(output)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	utils.Log.Errorf("Field ownership conflicts:")
+	for _, conflict := range conflicts {
+		utils.Log.Errorf("  %s is managed by %q", conflict.Field, conflict.Manager)
+	}
+	utils.Log.Infof("Remove the fields from the manifests, or take ownership with --force-conflicts=%s", c.Config.Stage)
+	return utils.NewError("server-side apply failed with %d conflict(s)", len(conflicts))
+}
+
+// parseApplyConflicts extracts the conflicting managers and fields from the
+// output of a failed server-side apply
+func parseApplyConflicts(output string) []fieldConflict {
+	var conflicts []fieldConflict
+	manager := ""
+	for _, line := range strings.Split(output, "\n") {
+		if match := conflictManager.FindStringSubmatch(line); match != nil {
+			manager = match[1]
+			if field := strings.TrimSpace(match[2]); strings.HasPrefix(field, ".") {
+				conflicts = append(conflicts, fieldConflict{Manager: manager, Field: field})
+			}
+			continue
+		}
+		if match := conflictField.FindStringSubmatch(line); match != nil && manager != "" {
+			conflicts = append(conflicts, fieldConflict{Manager: manager, Field: strings.TrimSpace(match[1])})
+			continue
+		}
+		// The field lists end at the first line that is neither a manager nor a field
+		if strings.TrimSpace(line) != "" {
+			manager = ""
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"helm-ci/deploy/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConflictOutput = `error: Apply failed with 3 conflicts: conflicts with "kube-controller-manager" using apps/v1:
+- .spec.replicas
+conflicts with "kubectl-edit" using apps/v1:
+- .spec.template.spec.containers[name="web"].image
+- .metadata.labels.tier
+Please review the fields above--they currently have other managers. Here
+are the ways you can resolve this warning:
+* If you intend to manage all of these fields, please re-run the apply
+  command with the ` + "`--force-conflicts`" + ` flag.
+`
+
+func TestParseApplyConflicts(t *testing.T) {
+	expected := []fieldConflict{
+		{Manager: "kube-controller-manager", Field: ".spec.replicas"},
+		{Manager: "kubectl-edit", Field: `.spec.template.spec.containers[name="web"].image`},
+		{Manager: "kubectl-edit", Field: ".metadata.labels.tier"},
+	}
+	if conflicts := parseApplyConflicts(testConflictOutput); !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Expected %v, got %v", expected, conflicts)
+	}
+
+	single := `error: Apply failed with 1 conflict: conflict with "hpa-controller": .spec.replicas`
+	expected = []fieldConflict{{Manager: "hpa-controller", Field: ".spec.replicas"}}
+	if conflicts := parseApplyConflicts(single); !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Expected %v, got %v", expected, conflicts)
+	}
+
+	if conflicts := parseApplyConflicts("error: the server could not find the requested resource"); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+}
+
+func newServerSideTestDeployer(t *testing.T, stage string) (*CustomDeployer, *MockCommander) {
+	t.Helper()
+	dir := t.TempDir()
+	writeManifests(t, dir, map[string]string{
+		stage + "/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+	})
+	mockCmd := NewMockCommander()
+	return &CustomDeployer{Common: Common{
+		Config: &config.Config{
+			ValuesPath:     dir,
+			Stage:          stage,
+			Namespace:      "web",
+			ServerSide:     true,
+			FieldManager:   "helm-ci",
+			ForceConflicts: []string{"dev"},
+		},
+		Cmd: mockCmd,
+	}}, mockCmd
+}
+
+func TestCustomDeployer_Deploy_ServerSide(t *testing.T) {
+	for _, tc := range []struct {
+		stage string
+		force bool
+	}{{"dev", true}, {"live", false}} {
+		t.Run(tc.stage, func(t *testing.T) {
+			deployer, mockCmd := newServerSideTestDeployer(t, tc.stage)
+			if err := deployer.Deploy(); err != nil {
+				t.Fatalf("Deploy failed: %v", err)
+			}
+
+			for _, cmd := range mockCmd.Commands {
+				if cmd.Name != "kubectl" || (cmd.Args[0] != "apply" && cmd.Args[0] != "diff") {
+					continue
+				}
+				args := strings.Join(cmd.Args, " ")
+				if !strings.Contains(args, "--server-side --field-manager=helm-ci") {
+					t.Errorf("Expected server-side apply flags, got %s", args)
+				}
+				if strings.Contains(args, "--force-conflicts") != tc.force {
+					t.Errorf("Expected --force-conflicts=%v in stage %s, got %s", tc.force, tc.stage, args)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomDeployer_Deploy_ServerSideConflicts(t *testing.T) {
+	deployer, mockCmd := newServerSideTestDeployer(t, "live")
+	mockCmd.AddResponse("kubectl:apply", []byte(testConflictOutput), errors.New("exit status 1"))
+
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "3 conflict(s)") {
+		t.Errorf("Expected a conflict error, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/utils"
+	"helm-ci/deploy/values"
+	"helm-ci/deploy/vault"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSetIndex limits list indexes in --set keys, as helm does
+const maxSetIndex = 65536
+
+// setArgs returns the --set, --set-string and --set-file flags for helm with
+// Vault placeholders resolved. Resolved secrets never appear on the command
+// line: a --set or --set-string value with placeholders is written to a
+// temporary file passed with --set-file, which also keeps helm from parsing
+// commas, dots and brackets in the secret. Other pairs of the same value are
+// passed as they are, and files containing placeholders are resolved into
+// temporary files. The returned function removes the files.
+func (d *HelmDeployer) setArgs() ([]string, func(), error) {
+	var args []string
+	var tmpFiles []string
+	cleanup := func() {
+		for _, file := range tmpFiles {
+			os.Remove(file)
+		}
+	}
+	writeResolved := func(content string) (string, error) {
+		tmpFile, err := os.CreateTemp("", "helm-ci-set-file-*")
+		if err != nil {
+			return "", utils.NewError("failed to create temp file: %v", err)
+		}
+		tmpFiles = append(tmpFiles, tmpFile.Name())
+		_, err = tmpFile.WriteString(content)
+		tmpFile.Close()
+		if err != nil {
+			return "", utils.NewError("failed to write temp file: %v", err)
+		}
+		return tmpFile.Name(), nil
+	}
+
+	for _, flagValues := range []struct {
+		flag   string
+		values []string
+	}{
+		{"--set", d.Config.Set},
+		{"--set-string", d.Config.SetString},
+	} {
+		for _, value := range flagValues.values {
+			if _, _, ok := strings.Cut(value, "="); !ok {
+				cleanup()
+				return nil, nil, utils.NewError("invalid %s value %q, expected key=value", flagValues.flag, value)
+			}
+			if !vault.HasPlaceholder(value) {
+				args = append(args, flagValues.flag, value)
+				continue
+			}
+
+			// Pairs with placeholders are passed on one by one, their value
+			// taken literally for a single key
+			for _, pair := range splitUnescaped(value, ',', true) {
+				key, raw, ok := cutUnescaped(pair, '=')
+				if !ok {
+					cleanup()
+					return nil, nil, utils.NewError("invalid %s value %q, expected key=value", flagValues.flag, value)
+				}
+				if !vault.HasPlaceholder(raw) {
+					args = append(args, flagValues.flag, pair)
+					continue
+				}
+				resolved, err := d.ResolvePlaceholders(raw)
+				if err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				file, err := writeResolved(resolved)
+				if err != nil {
+					cleanup()
+					return nil, nil, err
+				}
+				args = append(args, "--set-file", key+"="+file)
+			}
+		}
+	}
+
+	for _, value := range d.Config.SetFile {
+		key, file, ok := strings.Cut(value, "=")
+		if !ok || key == "" || file == "" {
+			cleanup()
+			return nil, nil, utils.NewError("invalid --set-file value %q, expected key=path", value)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			cleanup()
+			return nil, nil, utils.NewError("failed to read --set-file %s: %v", file, err)
+		}
+
+		if vault.HasPlaceholder(string(content)) {
+			resolved, err := d.ResolvePlaceholders(string(content))
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			if file, err = writeResolved(resolved); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+		}
+		args = append(args, "--set-file", key+"="+file)
+	}
+
+	// Record the values as given, so placeholders are reported instead of secrets
+	var recorded []string
+	for _, value := range d.Config.Set {
+		recorded = append(recorded, "--set "+value)
+	}
+	for _, value := range d.Config.SetString {
+		recorded = append(recorded, "--set-string "+value)
+	}
+	for _, value := range d.Config.SetFile {
+		recorded = append(recorded, "--set-file "+value)
+	}
+	if len(recorded) > 0 {
+		d.Summary.Set("Value overrides", utils.MaskSecrets(strings.Join(recorded, ", ")))
+	}
+
+	return args, cleanup, nil
+}
+
+// overrideLayers returns the --set, --set-string and --set-file overrides as a
+// values layer as given and with Vault placeholders resolved, so they are
+// validated together with the values files. Pairs with placeholders are
+// strings, as helm receives them through files.
+func (d *HelmDeployer) overrideLayers() (raw, processed []values.Layer, err error) {
+	if len(d.Config.Set)+len(d.Config.SetString)+len(d.Config.SetFile) == 0 {
+		return nil, nil, nil
+	}
+	rawValues := map[string]interface{}{}
+	processedValues := map[string]interface{}{}
+
+	for _, flagValues := range []struct {
+		flag  string
+		value []string
+		typed bool
+	}{
+		{"--set", d.Config.Set, true},
+		{"--set-string", d.Config.SetString, false},
+	} {
+		for _, value := range flagValues.value {
+			for _, pair := range splitUnescaped(value, ',', true) {
+				key, rawValue, ok := cutUnescaped(pair, '=')
+				if !ok {
+					return nil, nil, utils.NewError("invalid %s value %q, expected key=value", flagValues.flag, value)
+				}
+				if !vault.HasPlaceholder(rawValue) {
+					for _, dst := range []map[string]interface{}{rawValues, processedValues} {
+						if err := parseSetValues(dst, pair, flagValues.typed); err != nil {
+							return nil, nil, utils.NewError("invalid %s value %q: %v", flagValues.flag, value, err)
+						}
+					}
+					continue
+				}
+
+				resolved, err := d.ResolvePlaceholders(rawValue)
+				if err != nil {
+					return nil, nil, err
+				}
+				if err := setValue(rawValues, key, rawValue); err != nil {
+					return nil, nil, utils.NewError("invalid %s value %q: %v", flagValues.flag, value, err)
+				}
+				setValue(processedValues, key, resolved)
+			}
+		}
+	}
+
+	for _, value := range d.Config.SetFile {
+		key, file, _ := strings.Cut(value, "=")
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, utils.NewError("failed to read --set-file %s: %v", file, err)
+		}
+		resolved, err := d.ResolvePlaceholders(string(content))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := setValue(rawValues, key, string(content)); err != nil {
+			return nil, nil, utils.NewError("invalid --set-file value %q: %v", value, err)
+		}
+		setValue(processedValues, key, resolved)
+	}
+
+	name := "value overrides"
+	for _, layer := range []struct {
+		dst    *[]values.Layer
+		values map[string]interface{}
+	}{
+		{&raw, rawValues},
+		{&processed, processedValues},
+	} {
+		content, err := yaml.Marshal(layer.values)
+		if err != nil {
+			return nil, nil, utils.NewError("failed to encode value overrides: %v", err)
+		}
+		*layer.dst = []values.Layer{{Name: name, Content: content}}
+	}
+	return raw, processed, nil
+}
+
+// parseSetValues applies a helm --set argument of comma separated key=value
+// pairs to dst. Keys are split at dots and may index lists like hosts[0], a
+// backslash escapes the next character and {a,b} is a list. With typed, values
+// are typed as helm does for --set, otherwise they stay strings.
+func parseSetValues(dst map[string]interface{}, s string, typed bool) error {
+	for _, pair := range splitUnescaped(s, ',', true) {
+		key, value, ok := cutUnescaped(pair, '=')
+		if !ok {
+			return fmt.Errorf("key %q has no value", unescape(pair))
+		}
+
+		var parsed interface{}
+		if len(value) >= 2 && strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			list := []interface{}{}
+			if inner := value[1 : len(value)-1]; inner != "" {
+				for _, item := range splitUnescaped(inner, ',', false) {
+					list = append(list, typedSetValue(unescape(item), typed))
+				}
+			}
+			parsed = list
+		} else {
+			parsed = typedSetValue(unescape(value), typed)
+		}
+
+		if err := setValue(dst, key, parsed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typedSetValue converts a --set value like helm: booleans, null and integers
+// without leading zeros are typed, anything else is a string
+func typedSetValue(value string, typed bool) interface{} {
+	if !typed {
+		return value
+	}
+	switch {
+	case strings.EqualFold(value, "true"):
+		return true
+	case strings.EqualFold(value, "false"):
+		return false
+	case strings.EqualFold(value, "null"):
+		return nil
+	case value == "0":
+		return int64(0)
+	}
+	if value != "" && value[0] != '0' {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return value
+}
+
+// setValue sets the value at a --set key path in dst
+func setValue(dst map[string]interface{}, key string, value interface{}) error {
+	var path []interface{}
+	for _, part := range splitUnescaped(key, '.', false) {
+		name, indexes, _ := strings.Cut(part, "[")
+		if name == "" {
+			return fmt.Errorf("key %q has an empty name", key)
+		}
+		path = append(path, unescape(name))
+		if indexes == "" {
+			continue
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 || i > maxSetIndex {
+				return fmt.Errorf("key %q has an invalid list index %q", key, index)
+			}
+			path = append(path, i)
+		}
+	}
+	_, err := setPath(dst, path, value)
+	return err
+}
+
+// setPath sets value below node along path of map keys and list indexes and
+// returns the updated node
+func setPath(node interface{}, path []interface{}, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch segment := path[0].(type) {
+	case int:
+		list, _ := node.([]interface{})
+		for len(list) <= segment {
+			list = append(list, nil)
+		}
+		child, err := setPath(list[segment], path[1:], value)
+		list[segment] = child
+		return list, err
+	default:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+		}
+		child, err := setPath(m[segment.(string)], path[1:], value)
+		m[segment.(string)] = child
+		return m, err
+	}
+}
+
+// splitUnescaped splits s at sep characters that are not escaped with a
+// backslash. With braces, separators inside {} are kept.
+func splitUnescaped(s string, sep byte, braces bool) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case braces && s[i] == '{':
+			depth++
+		case braces && s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutUnescaped cuts s around the first sep that is not escaped
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	parts := splitUnescaped(s, sep, false)
+	if len(parts) == 1 {
+		return s, "", false
+	}
+	return parts[0], s[len(parts[0])+1:], true
+}
+
+// unescape removes the backslashes escaping characters
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"encoding/json"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newVaultTestServer(t *testing.T, secrets map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHelmDeployer_Deploy_SetValues(t *testing.T) {
+	server := newVaultTestServer(t, map[string]string{
+		"/v1/secret/data/app": `{"data": {"data": {"PASSWORD": "set-value-secret", "CERT": "cert-from-vault"}}}`,
+	})
+
+	setFile := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(setFile, []byte("<<vault.app/CERT>>"), 0644); err != nil {
+		t.Fatalf("Failed to write set file: %v", err)
+	}
+	plainFile := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(plainFile, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write set file: %v", err)
+	}
+
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{
+		Repository:     "https://charts.example.com",
+		VaultURL:       server.URL,
+		VaultBasePath:  "secret",
+		VaultKVVersion: 2,
+		Set:            []string{"replicas=2", "db.password=<<vault.app/PASSWORD>>", "db.user=app,db.dsn=app:<<vault.app/PASSWORD>>@db"},
+		SetString:      []string{"image.tag=1.0"},
+		SetFile:        []string{"tls.cert=" + setFile, "config=" + plainFile},
+	})
+	deployer.Summary = &Summary{}
+
+	// The resolved files are removed after the deploy, so read them when helm runs
+	resolvedSetFiles := map[string]string{}
+	mockCmd.OnCommand = func(cmd MockCommand) {
+		if cmd.Name != "helm" || cmd.Args[0] != "upgrade" {
+			return
+		}
+		for i, arg := range cmd.Args {
+			if arg == "--set-file" && i+1 < len(cmd.Args) {
+				key, file, _ := strings.Cut(cmd.Args[i+1], "=")
+				content, _ := os.ReadFile(file)
+				resolvedSetFiles[key] = string(content)
+			}
+		}
+	}
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var upgradeArgs string
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && cmd.Args[0] == "upgrade" {
+			upgradeArgs = strings.Join(cmd.Args, " ")
+		}
+	}
+	for _, expected := range []string{
+		"--set replicas=2",
+		"--set db.user=app",
+		"--set-string image.tag=1.0",
+		"--set-file config=" + plainFile,
+	} {
+		if !strings.Contains(upgradeArgs, expected) {
+			t.Errorf("Expected %q in upgrade args: %s", expected, upgradeArgs)
+		}
+	}
+	assertNoSecretInCommands(t, mockCmd, "set-value-secret")
+	for key, expected := range map[string]string{
+		"db.password": "set-value-secret",
+		"db.dsn":      "app:set-value-secret@db",
+	} {
+		if got := resolvedSetFiles[key]; got != expected {
+			t.Errorf("Expected --set-file %s with %q, got %q", key, expected, got)
+		}
+	}
+	if strings.Contains(upgradeArgs, "tls.cert="+setFile) {
+		t.Error("Expected the set file with placeholders to be replaced by a resolved copy")
+	}
+
+	overrides, _ := deployer.Summary.Get("Value overrides")
+	if !strings.Contains(overrides, "--set db.password=<<vault.app/PASSWORD>>") || strings.Contains(overrides, "set-value-secret") {
+		t.Errorf("Expected overrides with placeholders in summary, got %q", overrides)
+	}
+	if masked := utils.MaskSecrets("password: set-value-secret"); masked != "password: "+utils.SecretMask {
+		t.Errorf("Expected the resolved value to be masked, got %q", masked)
+	}
+}
+
+func TestHelmDeployer_Deploy_InvalidSetValue(t *testing.T) {
+	deployer, _ := newAuthTestDeployer(&config.Config{
+		Repository: "https://charts.example.com",
+		Set:        []string{"replicas"},
+	})
+
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "expected key=value") {
+		t.Errorf("Expected invalid --set error, got %v", err)
+	}
+}
+
+func TestParseSetValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		typed    bool
+		expected string
+	}{
+		{"typed scalars", "replicas=2,debug=true,tag=01,empty=null", true, `{"debug":true,"empty":null,"replicas":2,"tag":"01"}`},
+		{"strings", "replicas=2,debug=true", false, `{"debug":"true","replicas":"2"}`},
+		{"nested keys", "image.repository=nginx,image.tag=1.25", true, `{"image":{"repository":"nginx","tag":"1.25"}}`},
+		{"list index", "hosts[1].name=b", true, `{"hosts":[null,{"name":"b"}]}`},
+		{"list", "args={a,b\\,c,3}", true, `{"args":["a","b,c",3]}`},
+		{"escaped dot", "annotations.example\\.com/team=web", true, `{"annotations":{"example.com/team":"web"}}`},
+		{"equals in value", "dsn=user=app", true, `{"dsn":"user=app"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]interface{}{}
+			if err := parseSetValues(values, tt.value, tt.typed); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			encoded, _ := json.Marshal(values)
+			if string(encoded) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, encoded)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"replicas", "hosts[x]=a", ".name=a"} {
+		if err := parseSetValues(map[string]interface{}{}, invalid, true); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"helm-ci/deploy/utils"
+	"os"
+	"strings"
+)
+
+// Summary collects the facts of a deployment that are reported once it finished
+// All methods are safe to call on a nil Summary
+type Summary struct {
+	entries []SummaryEntry
+}
+
+// SummaryEntry is a single fact of the deployment summary
+type SummaryEntry struct {
+	Key   string
+	Value string
+}
+
+// Set records a fact, replacing an earlier value for the same key
+func (s *Summary) Set(key, value string) {
+	if s == nil {
+		return
+	}
+	for i := range s.entries {
+		if s.entries[i].Key == key {
+			s.entries[i].Value = value
+			return
+		}
+	}
+	s.entries = append(s.entries, SummaryEntry{Key: key, Value: value})
+}
+
+// Get returns the recorded value for a key
+func (s *Summary) Get(key string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	for _, entry := range s.entries {
+		if entry.Key == key {
+			return entry.Value, true
+		}
+	}
+	return "", false
+}
+
+// Entries returns all recorded facts in the order they were first set
+func (s *Summary) Entries() []SummaryEntry {
+	if s == nil {
+		return nil
+	}
+	return s.entries
+}
+
+// Print logs the summary
+func (s *Summary) Print() {
+	if s == nil || len(s.entries) == 0 {
+		return
+	}
+	utils.Log.Info("Deployment summary:")
+	for _, entry := range s.entries {
+		utils.Log.Infof("  %s: %s", entry.Key, entry.Value)
+	}
+}
+
+// WriteMarkdown appends the summary as a markdown table to the given file,
+// e.g. the file referenced by GITHUB_STEP_SUMMARY
+func (s *Summary) WriteMarkdown(path string) error {
+	if s == nil || len(s.entries) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("### Deployment summary\n\n| | |\n|---|---|\n")
+	for _, entry := range s.entries {
+		value := strings.ReplaceAll(entry.Value, "|", "\\|")
+		value = strings.ReplaceAll(value, "\n", "<br>")
+		fmt.Fprintf(&b, "| %s | %s |\n", entry.Key, value)
+	}
+	b.WriteString("\n")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return utils.NewError("failed to open summary file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(b.String()); err != nil {
+		return utils.NewError("failed to write summary file %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSummary_SetAndWriteMarkdown(t *testing.T) {
+	summary := &Summary{}
+	summary.Set("Release", "test-app")
+	summary.Set("Chart version", "1.0.0")
+	summary.Set("Chart version", "1.4.7")
+	summary.Set("Values", "a|b")
+
+	entries := summary.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[1].Value != "1.4.7" {
+		t.Errorf("Expected Set to replace the existing value, got %q", entries[1].Value)
+	}
+
+	summaryFile := filepath.Join(t.TempDir(), "summary.md")
+	if err := summary.WriteMarkdown(summaryFile); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+
+	content, err := os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatalf("Failed to read summary: %v", err)
+	}
+	for _, expected := range []string{"| Release | test-app |", "| Chart version | 1.4.7 |", `| Values | a\|b |`} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+func TestSummary_NilSafe(t *testing.T) {
+	var summary *Summary
+	summary.Set("Release", "test-app")
+	summary.Print()
+	if _, ok := summary.Get("Release"); ok {
+		t.Errorf("Expected nil summary to record nothing")
+	}
+	if err := summary.WriteMarkdown(filepath.Join(t.TempDir(), "summary.md")); err != nil {
+		t.Errorf("Expected nil summary to write nothing, got error: %v", err)
+	}
+}
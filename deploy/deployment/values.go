@@ -0,0 +1,278 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/templates"
+	"helm-ci/deploy/utils"
+	"helm-ci/deploy/values"
+	"helm-ci/deploy/vault"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// valuesExtensions are the accepted values file extensions
+var valuesExtensions = []string{".yaml", ".yml"}
+
+// ValuesLayers returns the configured layers with {env} and {stage} substituted
+// Layers referring to an unset environment or stage and the pr layer outside of
+// PR deployments are left out
+func (c *Common) ValuesLayers() []string {
+	layers := c.Config.ValuesLayers
+	if len(layers) == 0 {
+		layers = strings.Split(config.DefaultValuesLayers, ",")
+	}
+
+	var result []string
+	for _, layer := range layers {
+		if strings.Contains(layer, "{env}") && c.Config.Environment == "" {
+			continue
+		}
+		if strings.Contains(layer, "{stage}") && c.Config.Stage == "" {
+			continue
+		}
+		// Like the release name, a PR only gets its own values when deployed separately
+		if layer == "pr" && !(c.Config.Stage == "dev" && c.Config.PRNumber != "" && c.Config.PRDeployments) {
+			continue
+		}
+		layer = strings.ReplaceAll(layer, "{env}", c.Config.Environment)
+		layer = strings.ReplaceAll(layer, "{stage}", c.Config.Stage)
+		result = append(result, layer)
+	}
+	return result
+}
+
+// ValuesFiles resolves the layers to values files, lowest precedence first
+// Each layer contributes <layer>.yaml followed by the files of the drop-in
+// directory <layer>.d/ in lexical order
+func (c *Common) ValuesFiles() ([]string, error) {
+	var files []string
+	for _, layer := range c.ValuesLayers() {
+		base := filepath.Join(c.Config.ValuesPath, filepath.FromSlash(layer))
+
+		file, err := findValuesFile(base)
+		if err != nil {
+			return nil, err
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+
+		fragments, err := valuesFragments(base + ".d")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fragments...)
+	}
+	return files, nil
+}
+
+// findValuesFile returns base with the one existing values extension
+func findValuesFile(base string) (string, error) {
+	var found []string
+	for _, ext := range valuesExtensions {
+		info, err := os.Stat(base + ext)
+		if err == nil && !info.IsDir() {
+			found = append(found, base+ext)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", utils.NewError("failed to read values file %s: %v", base+ext, err)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", utils.NewError("ambiguous values files: %s", strings.Join(found, " and "))
+	}
+}
+
+// valuesFragments lists the values files of a drop-in directory in lexical order
+func valuesFragments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, utils.NewError("failed to read values directory %s: %v", dir, err)
+	}
+
+	byName := map[string]string{}
+	var names []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if existing, ok := byName[name]; ok {
+			return nil, utils.NewError("ambiguous values files: %s and %s", existing, filepath.Join(dir, entry.Name()))
+		}
+		byName[name] = filepath.Join(dir, entry.Name())
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, byName[name])
+	}
+	return files, nil
+}
+
+// valuesLayers holds the values layers as written and after Vault processing
+type valuesLayers struct {
+	files     []string
+	raw       []values.Layer
+	processed []values.Layer
+}
+
+// loadValuesLayers reads the generated domain values and the layered values files
+func (c *Common) loadValuesLayers() (*valuesLayers, error) {
+	layers := &valuesLayers{}
+
+	// Process domain template if domains are specified
+	if len(c.Config.Domains) > 0 {
+		domainValuesFile, err := templates.ProcessDomainTemplate(c.Config)
+		if err != nil {
+			return nil, err
+		}
+		if domainValuesFile != "" {
+			content, err := os.ReadFile(domainValuesFile)
+			os.Remove(domainValuesFile)
+			if err != nil {
+				return nil, utils.NewError("failed to read domain values: %v", err)
+			}
+			name := fmt.Sprintf("domain template %s", c.Config.DomainTemplate)
+			layers.raw = append(layers.raw, values.Layer{Name: name, Content: content})
+			layers.processed = append(layers.processed, values.Layer{Name: name, Content: content})
+		}
+	}
+
+	files, err := c.ValuesFiles()
+	if err != nil {
+		return nil, err
+	}
+	layers.files = files
+
+	for _, file := range files {
+		utils.Log.Debugf("Using values file %s", file)
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, utils.NewError("failed to read values file %s: %v", file, err)
+		}
+		// Provenance refers to the rendered file, Vault secrets are resolved afterwards
+		rendered, err := c.renderTemplate(file, content)
+		if err != nil {
+			return nil, err
+		}
+		layers.raw = append(layers.raw, values.Layer{Name: file, Content: rendered})
+
+		processed, err := c.resolveVaultContent(file, string(rendered))
+		if err != nil {
+			return nil, err
+		}
+		layers.processed = append(layers.processed, values.Layer{Name: file, Content: []byte(processed)})
+	}
+
+	return layers, nil
+}
+
+// writeMergedValues merges the processed layers into a single temporary values file
+// The caller removes the returned file
+func writeMergedValues(layers *valuesLayers) (string, error) {
+	merged, err := values.Merge(layers.processed)
+	if err != nil {
+		return "", utils.NewError("failed to merge values: %v", err)
+	}
+	content, err := merged.Marshal()
+	if err != nil {
+		return "", utils.NewError("failed to encode merged values: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "helm-ci-values-*.yaml")
+	if err != nil {
+		return "", utils.NewError("failed to create merged values file: %v", err)
+	}
+	defer tmpFile.Close()
+	if _, err := tmpFile.Write(content); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", utils.NewError("failed to write merged values file: %v", err)
+	}
+	return tmpFile.Name(), nil
+}
+
+// Explain prints every final values key with its value and the file and line
+// that supplied it. Values resolved from Vault are masked.
+func (d *HelmDeployer) Explain() error {
+	layers, err := d.loadValuesLayers()
+	if err != nil {
+		return err
+	}
+
+	raw, err := values.Merge(layers.raw)
+	if err != nil {
+		return utils.NewError("failed to merge values: %v", err)
+	}
+	processed, err := values.Merge(layers.processed)
+	if err != nil {
+		return utils.NewError("failed to merge values: %v", err)
+	}
+
+	rawValues := map[string]interface{}{}
+	for _, leaf := range raw.Leaves() {
+		rawValues[leaf.Path] = leaf.Value
+	}
+
+	utils.Green("Values of %s in %s:", d.Config.ReleaseName, d.Config.Stage)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, leaf := range processed.Leaves() {
+		// Line numbers of the files as written, as Vault may insert lines
+		source := leaf.Source
+		if rawSource, ok := raw.Source(leaf.Path); ok {
+			source = rawSource
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", leaf.Path, explainValue(leaf.Value, rawValues[leaf.Path]), source)
+	}
+	return w.Flush()
+}
+
+// explainValue renders a value for the explain output, masking values that
+// came from Vault
+func explainValue(value, rawValue interface{}) string {
+	rendered := renderValue(value)
+	rawRendered := renderValue(rawValue)
+	if rendered != rawRendered || vault.HasPlaceholder(rawRendered) {
+		return "******"
+	}
+	return rendered
+}
+
+func renderValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"helm-ci/deploy/schema"
+	"helm-ci/deploy/utils"
+	"helm-ci/deploy/values"
+	"os"
+	"path/filepath"
+)
+
+// valuesSchemaFile is the name of the values schema in charts and values paths
+const valuesSchemaFile = "values.schema.json"
+
+// validateValues validates the merged values and value overrides against the
+// repository schema and the chart's values.schema.json before helm runs. Every
+// violation is reported with its key path and the values file that set it.
+func (d *HelmDeployer) validateValues(layers *valuesLayers, chart string, chartArgs []string, version string) error {
+	if !d.Config.ValidateValues {
+		return nil
+	}
+
+	// Single value overrides take precedence over all values files
+	overridesRaw, overridesProcessed, err := d.overrideLayers()
+	if err != nil {
+		return err
+	}
+	raw := append(append([]values.Layer{}, layers.raw...), overridesRaw...)
+	processed := append(append([]values.Layer{}, layers.processed...), overridesProcessed...)
+
+	var violations []string
+
+	// The repository schema describes the values of this repository only
+	repoSchema, repoSchemaPath, err := d.repoValuesSchema()
+	if err != nil {
+		return err
+	}
+	if repoSchema != nil {
+		found, err := schemaViolations(repoSchema, raw, processed)
+		if err != nil {
+			return err
+		}
+		for _, violation := range found {
+			violations = append(violations, fmt.Sprintf("%s: %s", repoSchemaPath, violation))
+		}
+	}
+
+	// The chart schema applies to the values coalesced with the chart defaults
+	chartSchema, chartDefaults, err := d.chartValuesSchema(chart, chartArgs, version)
+	if err != nil {
+		return err
+	}
+	if chartSchema != nil {
+		found, err := schemaViolations(chartSchema,
+			append([]values.Layer{chartDefaults}, raw...),
+			append([]values.Layer{chartDefaults}, processed...))
+		if err != nil {
+			return err
+		}
+		for _, violation := range found {
+			violations = append(violations, fmt.Sprintf("chart %s: %s", valuesSchemaFile, violation))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	for _, violation := range violations {
+		utils.Log.Errorf("  %s", violation)
+	}
+	return utils.NewError("values do not match the schema: %d violation(s)", len(violations))
+}
+
+// schemaViolations validates the merged processed layers and locates every
+// violation in the raw layers
+func schemaViolations(s *schema.Schema, raw, processed []values.Layer) ([]string, error) {
+	merged, err := values.Merge(processed)
+	if err != nil {
+		return nil, utils.NewError("failed to merge values: %v", err)
+	}
+	sources, err := values.Merge(raw)
+	if err != nil {
+		return nil, utils.NewError("failed to merge values: %v", err)
+	}
+
+	// Like Helm, validate with null values removed, as they delete chart defaults
+	var result []string
+	for _, violation := range s.Validate(withoutNulls(merged.Values())) {
+		message := violation.String()
+		if source, ok := sources.Locate(violation.Path); ok {
+			message += fmt.Sprintf(" (%s)", source)
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
+
+// repoValuesSchema loads --values-schema, or values.schema.json in the values path
+func (d *HelmDeployer) repoValuesSchema() (*schema.Schema, string, error) {
+	path := d.Config.ValuesSchema
+	if path == "" {
+		path = filepath.Join(d.Config.ValuesPath, valuesSchemaFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, "", nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", utils.NewError("failed to read values schema %s: %v", path, err)
+	}
+	s, err := schema.Parse(content)
+	if err != nil {
+		return nil, "", utils.NewError("failed to parse values schema %s: %v", path, err)
+	}
+	return s, path, nil
+}
+
+// chartValuesSchema returns the chart's values schema together with its default
+// values, or a nil schema if the chart has none. Remote charts are pulled for
+// inspection; if that fails the chart schema is left to helm.
+func (d *HelmDeployer) chartValuesSchema(chart string, chartArgs []string, version string) (*schema.Schema, values.Layer, error) {
+	source := chart
+	if !IsLocalChart(chart) {
+		dir, err := os.MkdirTemp("", "helm-ci-chart-*")
+		if err != nil {
+			return nil, values.Layer{}, utils.NewError("failed to create chart download directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		pulled, _, _, err := d.pullChart(chart, chartArgs, version, dir)
+		if err != nil {
+			utils.Log.Warningf("Skipping the chart values schema check: %v", err)
+			return nil, values.Layer{}, nil
+		}
+		source = pulled
+	}
+
+	content, err := readChartFile(source, valuesSchemaFile)
+	if err != nil {
+		return nil, values.Layer{}, utils.NewError("failed to read %s of %s: %v", valuesSchemaFile, chart, err)
+	}
+	if content == nil {
+		return nil, values.Layer{}, nil
+	}
+	s, err := schema.Parse(content)
+	if err != nil {
+		return nil, values.Layer{}, utils.NewError("failed to parse %s of %s: %v", valuesSchemaFile, chart, err)
+	}
+
+	defaults, err := readChartFile(source, "values.yaml")
+	if err != nil {
+		return nil, values.Layer{}, utils.NewError("failed to read default values of %s: %v", chart, err)
+	}
+	return s, values.Layer{Name: "chart values.yaml", Content: defaults}, nil
+}
+
+// withoutNulls returns a copy of the values without null entries
+func withoutNulls(in map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for key, value := range in {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			out[key] = withoutNulls(v)
+		default:
+			out[key] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"helm-ci/deploy/schema"
+	"helm-ci/deploy/values"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testChartSchema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["image"],
+  "properties": {
+    "replicaCount": {"type": "integer"},
+    "image": {
+      "type": "object",
+      "required": ["repository"],
+      "properties": {"repository": {"type": "string"}, "tag": {"type": "string"}}
+    },
+    "ingress": {"type": "object"}
+  }
+}`
+
+func newSchemaTestDeployer(t *testing.T, valuesFiles map[string]string) (*HelmDeployer, *MockCommander) {
+	t.Helper()
+	chartDir := writeLocalChart(t, "apiVersion: v2\nname: myapp\nversion: 0.1.0\n", false)
+	t.Cleanup(func() { os.RemoveAll(chartDir) })
+	if err := os.WriteFile(filepath.Join(chartDir, "values.schema.json"), []byte(testChartSchema), 0644); err != nil {
+		t.Fatalf("Failed to write chart schema: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("image:\n  repository: nginx\n  tag: \"1.25\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write chart values: %v", err)
+	}
+
+	valuesDir := t.TempDir()
+	for name, content := range valuesFiles {
+		if err := os.WriteFile(filepath.Join(valuesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	deployer, mockCmd := newAuthTestDeployer(&config.Config{
+		Stage:          "live",
+		ValuesPath:     valuesDir,
+		ValidateValues: true,
+	})
+	deployer.Config.Chart = chartDir
+	return deployer, mockCmd
+}
+
+func TestHelmDeployer_Deploy_ValidValuesPassSchema(t *testing.T) {
+	deployer, mockCmd := newSchemaTestDeployer(t, map[string]string{
+		"common.yaml": "replicaCount: 2\n",
+		"live.yaml":   "image:\n  tag: null\n",
+	})
+
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last, _ := mockCmd.GetLastCommand(); last.Args[0] != "upgrade" {
+		t.Errorf("Expected helm upgrade to run, got %v", last.Args)
+	}
+}
+
+func TestHelmDeployer_Deploy_SchemaViolationsStopDeployment(t *testing.T) {
+	deployer, mockCmd := newSchemaTestDeployer(t, map[string]string{
+		"common.yaml":        "replicaCount: two\n",
+		"live.yaml":          "ingres:\n  enabled: true\n",
+		"values.schema.json": `{"type": "object", "required": ["team"]}`,
+	})
+
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "3 violation(s)") {
+		t.Fatalf("Expected 3 schema violations, got %v", err)
+	}
+	for _, cmd := range mockCmd.Commands {
+		if cmd.Name == "helm" && cmd.Args[0] == "upgrade" {
+			t.Error("Expected no helm upgrade after schema violations")
+		}
+	}
+}
+
+func TestSchemaViolations_ReportOriginatingFile(t *testing.T) {
+	s, err := schema.Parse([]byte(testChartSchema))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	layers := []values.Layer{
+		{Name: "chart values.yaml", Content: []byte("image:\n  repository: nginx\n")},
+		{Name: "values/common.yaml", Content: []byte("replicaCount: 1\n")},
+		{Name: "values/live.yaml", Content: []byte("replicaCount: 2\ningres:\n  enabled: true\n")},
+	}
+
+	violations, err := schemaViolations(s, layers, layers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "ingres: unknown key, additional properties are not allowed (values/live.yaml:2)"
+	if len(violations) != 1 || violations[0] != expected {
+		t.Errorf("Expected [%s], got %v", expected, violations)
+	}
+}
+
+func TestHelmDeployer_Deploy_SchemaIncludesValueOverrides(t *testing.T) {
+	files := map[string]string{
+		"common.yaml":        "image:\n  tag: \"1.0\"\n",
+		"values.schema.json": `{"type": "object", "required": ["replicaCount"]}`,
+	}
+
+	deployer, _ := newSchemaTestDeployer(t, files)
+	deployer.Config.Set = []string{"replicaCount=3"}
+	if err := deployer.Deploy(); err != nil {
+		t.Fatalf("Expected --set to satisfy the schema, got %v", err)
+	}
+
+	deployer, _ = newSchemaTestDeployer(t, files)
+	deployer.Config.SetString = []string{"replicaCount=3"}
+	err := deployer.Deploy()
+	if err == nil || !strings.Contains(err.Error(), "1 violation(s)") {
+		t.Errorf("Expected the --set-string override to violate the schema, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"helm-ci/deploy/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeValuesFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("key: "+name+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestCommon_ValuesFiles_Layering(t *testing.T) {
+	dir := t.TempDir()
+	writeValuesFiles(t, dir,
+		"common.yaml",
+		"common.d/20-ingress.yaml",
+		"common.d/10-resources.yml",
+		"common.d/notes.txt",
+		"prod/common.yaml",
+		"live.yml",
+		"prod/live.yaml",
+		"pr.yaml",
+		"dev.yaml",
+	)
+
+	testCases := []struct {
+		name          string
+		stage         string
+		prNumber      string
+		prDeployments bool
+		expected      []string
+	}{
+		{
+			name:  "live stage",
+			stage: "live",
+			expected: []string{
+				"common.yaml",
+				"common.d/10-resources.yml",
+				"common.d/20-ingress.yaml",
+				"prod/common.yaml",
+				"live.yml",
+				"prod/live.yaml",
+			},
+		},
+		{
+			name:          "pr deployment",
+			stage:         "dev",
+			prNumber:      "42",
+			prDeployments: true,
+			expected: []string{
+				"common.yaml",
+				"common.d/10-resources.yml",
+				"common.d/20-ingress.yaml",
+				"prod/common.yaml",
+				"dev.yaml",
+				"pr.yaml",
+			},
+		},
+		{
+			name:     "pr number without pr deployments",
+			stage:    "dev",
+			prNumber: "42",
+			expected: []string{
+				"common.yaml",
+				"common.d/10-resources.yml",
+				"common.d/20-ingress.yaml",
+				"prod/common.yaml",
+				"dev.yaml",
+			},
+		},
+		{
+			name:          "pr number outside of dev",
+			stage:         "live",
+			prNumber:      "42",
+			prDeployments: true,
+			expected: []string{
+				"common.yaml",
+				"common.d/10-resources.yml",
+				"common.d/20-ingress.yaml",
+				"prod/common.yaml",
+				"live.yml",
+				"prod/live.yaml",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Common{Config: &config.Config{
+				ValuesPath:    dir,
+				Environment:   "prod",
+				Stage:         tc.stage,
+				PRNumber:      tc.prNumber,
+				PRDeployments: tc.prDeployments,
+			}}
+
+			files, err := c.ValuesFiles()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var rel []string
+			for _, file := range files {
+				r, _ := filepath.Rel(dir, file)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			if !reflect.DeepEqual(rel, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, rel)
+			}
+		})
+	}
+}
+
+func TestCommon_ValuesFiles_CustomLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeValuesFiles(t, dir, "base.yaml", "dev.yaml", "regions/eu.yaml")
+
+	c := &Common{Config: &config.Config{
+		ValuesPath:   dir,
+		Stage:        "dev",
+		ValuesLayers: []string{"{stage}", "base", "regions/eu"},
+	}}
+
+	files, err := c.ValuesFiles()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "dev.yaml"),
+		filepath.Join(dir, "base.yaml"),
+		filepath.Join(dir, "regions", "eu.yaml"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestCommon_ValuesFiles_Ambiguous(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files []string
+	}{
+		{"layer file", []string{"common.yaml", "common.yml"}},
+		{"fragment", []string{"common.d/a.yaml", "common.d/a.yml"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeValuesFiles(t, dir, tc.files...)
+
+			c := &Common{Config: &config.Config{ValuesPath: dir, Stage: "dev"}}
+			_, err := c.ValuesFiles()
+			if err == nil || !strings.Contains(err.Error(), "ambiguous values files") {
+				t.Errorf("Expected ambiguous values files error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExplainValue_MasksVaultValues(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		raw      interface{}
+		expected string
+	}{
+		{"plain value", "nginx", "nginx", `"nginx"`},
+		{"list", []interface{}{80, 443}, []interface{}{80, 443}, "[80,443]"},
+		{"resolved secret", "s3cr3t", "<<vault.secret/app/PASSWORD>>", "******"},
+		{"null", nil, nil, "null"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := explainValue(tc.value, tc.raw); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -22,6 +22,15 @@ import (
 )
 
 func main() {
+	// Run as Helm post-renderer; stdout carries the manifests, so log to stderr
+	if len(os.Args) > 1 && os.Args[1] == config.PostRenderCommand {
+		utils.Log.SetOutput(os.Stderr)
+		if err := deployment.PostRender(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Parse command line flags
 	cfg := config.ParseFlags()
 
@@ -46,10 +55,37 @@ func main() {
 	}
 
 	// Run deployment
-	if err := deployer.Deploy(); err != nil {
+	var err error
+	switch cfg.Command {
+	case "explain", "promote":
+		helmDeployer, ok := deployer.(*deployment.HelmDeployer)
+		if !ok {
+			utils.NewError("%s is only supported for Helm deployments", cfg.Command)
+			os.Exit(1)
+		}
+		if cfg.Command == "explain" {
+			if err := helmDeployer.Explain(); err != nil {
+				utils.NewError("Explain failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		err = helmDeployer.Promote()
+	default:
+		err = deployer.Deploy()
+	}
+	if err != nil {
 		utils.NewError("Deployment failed: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Report what was deployed
+	common.Summary.Print()
+	if summaryFile := os.Getenv("GITHUB_STEP_SUMMARY"); summaryFile != "" {
+		if err := common.Summary.WriteMarkdown(summaryFile); err != nil {
+			utils.Log.Warningf("Failed to write job summary: %v", err)
+		}
+	}
+
 	utils.Success("Deployment succeeded")
 }
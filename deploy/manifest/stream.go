@@ -0,0 +1,181 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest reads and writes multi-document Kubernetes manifest streams
+package manifest
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is one document of a YAML stream
+type Document struct {
+	// Node is the parsed document, nil if the document is empty or invalid
+	Node *yaml.Node
+	// Err is the parse error of an invalid document
+	Err error
+	// Changed marks documents that Write encodes from Node; all other
+	// documents are written exactly as they were read
+	Changed bool
+
+	separator []byte
+	raw       []byte
+}
+
+// Read splits a YAML stream into its documents. Only "---" at the start of a
+// line separates documents, which YAML forbids inside scalars, so block
+// scalars and quoted strings containing "---" stay intact. Empty and invalid
+// documents are kept so the stream can be written back unchanged.
+func Read(content []byte) []*Document {
+	var docs []*Document
+	current := &Document{}
+
+	for len(content) > 0 {
+		line := content
+		if idx := bytes.IndexByte(content, '\n'); idx >= 0 {
+			line = content[:idx+1]
+		}
+		content = content[len(line):]
+
+		if separator, rest, ok := cutSeparator(line); ok {
+			if current.separator != nil || len(current.raw) > 0 {
+				docs = append(docs, current)
+			}
+			current = &Document{separator: separator, raw: append([]byte{}, rest...)}
+			continue
+		}
+		current.raw = append(current.raw, line...)
+	}
+	if current.separator != nil || len(current.raw) > 0 {
+		docs = append(docs, current)
+	}
+
+	for _, doc := range docs {
+		doc.parse()
+	}
+	return docs
+}
+
+// cutSeparator splits a document separator line into the "---" marker with its
+// trailing whitespace and any content following it on the same line
+func cutSeparator(line []byte) ([]byte, []byte, bool) {
+	if !bytes.HasPrefix(line, []byte("---")) {
+		return nil, nil, false
+	}
+	i := 3
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\r' || line[i] == '\n') {
+		i++
+	}
+	if i == 3 && i < len(line) {
+		// "----" or "---foo" is content, not a separator
+		return nil, nil, false
+	}
+	return line[:i], line[i:], true
+}
+
+func (d *Document) parse() {
+	var node yaml.Node
+	if err := yaml.Unmarshal(d.raw, &node); err != nil {
+		d.Err = err
+		return
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		d.Node = &node
+	}
+}
+
+// Raw returns the source of the document as it was read
+func (d *Document) Raw() []byte {
+	return d.raw
+}
+
+// Root returns the top-level mapping of the document, or nil if it has none
+func (d *Document) Root() *yaml.Node {
+	if d.Node == nil || d.Node.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return d.Node.Content[0]
+}
+
+// Kind returns the kind of the resource in the document, or "" if it has none
+func (d *Document) Kind() string {
+	return d.field("kind")
+}
+
+// APIVersion returns the apiVersion of the resource in the document
+func (d *Document) APIVersion() string {
+	return d.field("apiVersion")
+}
+
+func (d *Document) field(key string) string {
+	root := d.Root()
+	if root == nil {
+		return ""
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key && root.Content[i+1].Kind == yaml.ScalarNode {
+			return root.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// Write joins documents back into a YAML stream. Changed documents are
+// encoded from their nodes with comments; all others keep their source.
+// Documents may come from several streams.
+func Write(docs []*Document) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		// Documents from different streams may lack a separator or final newline
+		if i > 0 {
+			if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+				buf.WriteByte('\n')
+			}
+			if doc.separator == nil {
+				buf.WriteString("---\n")
+			}
+		}
+
+		if !doc.Changed || doc.Node == nil {
+			buf.Write(doc.separator)
+			buf.Write(doc.raw)
+			continue
+		}
+
+		if doc.separator != nil {
+			buf.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc.Node); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Changed reports whether any document was marked as changed
+func Changed(docs []*Document) bool {
+	for _, doc := range docs {
+		if doc.Changed {
+			return true
+		}
+	}
+	return false
+}
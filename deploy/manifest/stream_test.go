@@ -0,0 +1,115 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const testStream = `# Leading comment
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: certs
+data:
+  ca.pem: |
+    -----BEGIN CERTIFICATE-----
+    MIIBszCCAVmgAwIBAgIUQ
+    -----END CERTIFICATE-----
+  notes.md: "Title\n---\nBody"
+---
+---
+# Source: chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web # the web service
+--- # trailing comment on separator
+kind: Broken
+  bad: indentation
+`
+
+func TestRead(t *testing.T) {
+	docs := Read([]byte(testStream))
+	if len(docs) != 4 {
+		t.Fatalf("Expected 4 documents, got %d", len(docs))
+	}
+
+	if docs[0].Kind() != "ConfigMap" || docs[0].APIVersion() != "v1" {
+		t.Errorf("Expected v1 ConfigMap, got %s %s", docs[0].APIVersion(), docs[0].Kind())
+	}
+	if !strings.Contains(string(docs[0].Raw()), "-----END CERTIFICATE-----") {
+		t.Errorf("Expected the certificate to stay in the first document, got:\n%s", docs[0].Raw())
+	}
+	if docs[1].Node != nil || docs[1].Err != nil {
+		t.Errorf("Expected an empty second document, got %+v", docs[1])
+	}
+	if docs[2].Kind() != "Service" {
+		t.Errorf("Expected a Service, got %q", docs[2].Kind())
+	}
+	if docs[3].Err == nil || docs[3].Node != nil {
+		t.Errorf("Expected the last document to be invalid, got %+v", docs[3])
+	}
+}
+
+func TestWrite_UnchangedRoundTrip(t *testing.T) {
+	for _, content := range []string{testStream, "", "kind: A", "---\nkind: A\n---\nkind: B\n"} {
+		out, err := Write(Read([]byte(content)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(out) != content {
+			t.Errorf("Expected the stream to be unchanged, got:\n%s\nwant:\n%s", out, content)
+		}
+	}
+}
+
+func TestWrite_ChangedDocumentKeepsComments(t *testing.T) {
+	docs := Read([]byte(testStream))
+	root := docs[2].Root()
+	metadata := root.Content[5]
+	metadata.Content[1].Value = "api"
+	docs[2].Changed = true
+
+	out, err := Write(docs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"# Source: chart/templates/service.yaml\n",
+		"name: api # the web service\n",
+		"    -----BEGIN CERTIFICATE-----\n",
+		"--- # trailing comment on separator\nkind: Broken\n",
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("Expected %q in output, got:\n%s", expected, out)
+		}
+	}
+	if len(Read(out)) != 4 {
+		t.Errorf("Expected 4 documents after writing, got:\n%s", out)
+	}
+}
+
+func TestWrite_JoinsStreams(t *testing.T) {
+	docs := append(Read([]byte("kind: A")), Read([]byte("kind: B\n---\nkind: C\n"))...)
+	out, err := Write(docs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "kind: A\n---\nkind: B\n---\nkind: C\n" {
+		t.Errorf("Unexpected stream:\n%s", out)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Loader loads schemas whose $refs point into other documents, such as the
+// _definitions.json shared by the Kubernetes schemas. Every document is read
+// and parsed once and shared by the schemas of the loader.
+type Loader struct {
+	read      func(uri string) ([]byte, error)
+	documents map[string]interface{}
+}
+
+// NewLoader returns a loader reading documents with read, which receives the
+// document part of a reference resolved against the referring document
+func NewLoader(read func(uri string) ([]byte, error)) *Loader {
+	return &Loader{read: read, documents: map[string]interface{}{}}
+}
+
+// Load reads and parses the schema at uri
+func (l *Loader) Load(uri string) (*Schema, error) {
+	root, err := l.document(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root, patterns: map[string]*regexp.Regexp{}, loader: l}, nil
+}
+
+// document returns the parsed document at uri with every $ref in it made
+// absolute, so references keep pointing at the right document wherever
+// the referring schema ends up
+func (l *Loader) document(uri string) (interface{}, error) {
+	if doc, ok := l.documents[uri]; ok {
+		return doc, nil
+	}
+	content, err := l.read(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema %s: %v", uri, err)
+	}
+	parsed, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %v", uri, err)
+	}
+	absoluteRefs(parsed.root, uri)
+	l.documents[uri] = parsed.root
+	return parsed.root, nil
+}
+
+// absoluteRefs rewrites the $refs of a document at base to base-relative URIs
+func absoluteRefs(node interface{}, base string) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				v[key] = resolveURI(base, ref)
+				continue
+			}
+			absoluteRefs(item, base)
+		}
+	case []interface{}:
+		for _, item := range v {
+			absoluteRefs(item, base)
+		}
+	}
+}
+
+// resolveURI resolves a reference against the URI of the referring document
+func resolveURI(base, ref string) string {
+	uri, fragment, _ := strings.Cut(ref, "#")
+	switch {
+	case uri == "":
+		uri = base
+	case !strings.Contains(uri, "://") && !path.IsAbs(uri):
+		uri = path.Join(path.Dir(base), uri)
+	}
+	return uri + "#" + fragment
+}
@@ -0,0 +1,517 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema validates decoded YAML or JSON documents against JSON Schemas
+//
+// The commonly used keywords of draft 4 to 2020-12 are supported: type, enum,
+// const, properties, patternProperties, additionalProperties, required, items,
+// min/maxItems, uniqueItems, min/maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not and
+// $ref pointers, which may point into other documents when the schema is read
+// by a Loader. Unknown keywords such as format are ignored.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a parsed JSON Schema document
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+	// loader resolves references to other documents, nil for a parsed schema
+	loader *Loader
+}
+
+// Violation is a single schema violation
+type Violation struct {
+	// Path holds the keys leading to the invalid value; list indices are written as "[n]"
+	Path    []string
+	Message string
+}
+
+func (v Violation) String() string {
+	if len(v.Path) == 0 {
+		return v.Message
+	}
+	var path strings.Builder
+	for i, key := range v.Path {
+		if i > 0 && !strings.HasPrefix(key, "[") {
+			path.WriteByte('.')
+		}
+		path.WriteString(key)
+	}
+	return path.String() + ": " + v.Message
+}
+
+// Parse reads a JSON Schema written as JSON or YAML
+func Parse(content []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(content, &root); err != nil {
+		// YAML is a superset of JSON, so YAML schemas are accepted as well
+		if yamlErr := yaml.Unmarshal(content, &root); yamlErr != nil {
+			return nil, fmt.Errorf("invalid schema: %v", err)
+		}
+	}
+	if _, ok := root.(map[string]interface{}); !ok {
+		if _, ok := root.(bool); !ok {
+			return nil, fmt.Errorf("invalid schema: expected an object")
+		}
+	}
+	return &Schema{root: root, patterns: map[string]*regexp.Regexp{}}, nil
+}
+
+// Validate checks a document decoded from YAML or JSON and returns every violation
+func (s *Schema) Validate(value interface{}) []Violation {
+	var violations []Violation
+	s.validate(s.root, normalize(value), nil, &violations)
+	return violations
+}
+
+func (s *Schema) validate(schema interface{}, value interface{}, path []string, violations *[]Violation) {
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{
+			Path:    append([]string{}, path...),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			add("no value is allowed here")
+		}
+		return
+	}
+	sch, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := sch["$ref"].(string); ok {
+		target, err := s.resolveRef(ref)
+		if err != nil {
+			add("%v", err)
+			return
+		}
+		s.validate(target, value, path, violations)
+		// Before draft 2019-09 siblings of $ref are ignored; later drafts apply them,
+		// which is the stricter behavior used here
+	}
+
+	if types, ok := schemaTypes(sch["type"]); ok {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("expected %s, got %s", strings.Join(types, " or "), typeName(value))
+			// Further keywords would only repeat the type mismatch
+			return
+		}
+	}
+
+	if enum, ok := sch["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if equal(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("must be one of %s, got %s", render(enum), render(value))
+		}
+	}
+
+	if constValue, ok := sch["const"]; ok && !equal(constValue, value) {
+		add("must be %s, got %s", render(constValue), render(value))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(sch, v, path, violations, add)
+	case []interface{}:
+		s.validateArray(sch, v, path, violations, add)
+	case string:
+		length := len([]rune(v))
+		if min, ok := number(sch["minLength"]); ok && float64(length) < min {
+			add("must be at least %s characters long", formatNumber(min))
+		}
+		if max, ok := number(sch["maxLength"]); ok && float64(length) > max {
+			add("must be at most %s characters long", formatNumber(max))
+		}
+		if pattern, ok := sch["pattern"].(string); ok {
+			re, err := s.pattern(pattern)
+			if err != nil {
+				add("invalid pattern %q in schema: %v", pattern, err)
+			} else if !re.MatchString(v) {
+				add("%s does not match pattern %q", render(v), pattern)
+			}
+		}
+	case float64:
+		s.validateNumber(sch, v, add)
+	}
+
+	if all, ok := sch["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, violations)
+		}
+	}
+	if anyOf, ok := sch["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if s.matches(sub, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("does not match any of the allowed schemas")
+		}
+	}
+	if oneOf, ok := sch["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if s.matches(sub, value) {
+				count++
+			}
+		}
+		if count == 0 {
+			add("does not match any of the allowed schemas")
+		} else if count > 1 {
+			add("matches %d schemas but must match exactly one", count)
+		}
+	}
+	if not, ok := sch["not"]; ok && s.matches(not, value) {
+		add("must not match the schema")
+	}
+}
+
+func (s *Schema) validateObject(sch map[string]interface{}, obj map[string]interface{}, path []string, violations *[]Violation, add func(string, ...interface{})) {
+	if required, ok := sch["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := obj[name]; !exists {
+					add("%s is required", name)
+				}
+			}
+		}
+	}
+	if min, ok := number(sch["minProperties"]); ok && float64(len(obj)) < min {
+		add("must have at least %s properties", formatNumber(min))
+	}
+	if max, ok := number(sch["maxProperties"]); ok && float64(len(obj)) > max {
+		add("must have at most %s properties", formatNumber(max))
+	}
+
+	properties, _ := sch["properties"].(map[string]interface{})
+	patternProperties, _ := sch["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := sch["additionalProperties"]
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := append(append([]string{}, path...), key)
+		matched := false
+
+		if propSchema, ok := properties[key]; ok {
+			matched = true
+			s.validate(propSchema, obj[key], keyPath, violations)
+		}
+		for pattern, patternSchema := range patternProperties {
+			re, err := s.pattern(pattern)
+			if err == nil && re.MatchString(key) {
+				matched = true
+				s.validate(patternSchema, obj[key], keyPath, violations)
+			}
+		}
+
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok {
+			if !allowed {
+				*violations = append(*violations, Violation{Path: keyPath, Message: "unknown key, additional properties are not allowed"})
+			}
+			continue
+		}
+		s.validate(additional, obj[key], keyPath, violations)
+	}
+}
+
+func (s *Schema) validateArray(sch map[string]interface{}, arr []interface{}, path []string, violations *[]Violation, add func(string, ...interface{})) {
+	if min, ok := number(sch["minItems"]); ok && float64(len(arr)) < min {
+		add("must have at least %s items", formatNumber(min))
+	}
+	if max, ok := number(sch["maxItems"]); ok && float64(len(arr)) > max {
+		add("must have at most %s items", formatNumber(max))
+	}
+	if unique, ok := sch["uniqueItems"].(bool); ok && unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					add("items %d and %d are equal but must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	// items is a single schema, or in older drafts a list of positional schemas;
+	// prefixItems is the 2020-12 spelling of the positional form
+	positional, _ := sch["prefixItems"].([]interface{})
+	itemSchema, hasItems := sch["items"]
+	if list, ok := itemSchema.([]interface{}); ok {
+		positional = list
+		itemSchema, hasItems = sch["additionalItems"]
+	}
+
+	for i, item := range arr {
+		itemPath := append(append([]string{}, path...), "["+strconv.Itoa(i)+"]")
+		switch {
+		case i < len(positional):
+			s.validate(positional[i], item, itemPath, violations)
+		case hasItems:
+			s.validate(itemSchema, item, itemPath, violations)
+		}
+	}
+}
+
+func (s *Schema) validateNumber(sch map[string]interface{}, v float64, add func(string, ...interface{})) {
+	if min, ok := number(sch["minimum"]); ok {
+		if exclusive, _ := sch["exclusiveMinimum"].(bool); exclusive && v <= min {
+			add("must be > %s, got %s", formatNumber(min), formatNumber(v))
+		} else if v < min {
+			add("must be >= %s, got %s", formatNumber(min), formatNumber(v))
+		}
+	}
+	if max, ok := number(sch["maximum"]); ok {
+		if exclusive, _ := sch["exclusiveMaximum"].(bool); exclusive && v >= max {
+			add("must be < %s, got %s", formatNumber(max), formatNumber(v))
+		} else if v > max {
+			add("must be <= %s, got %s", formatNumber(max), formatNumber(v))
+		}
+	}
+	if min, ok := number(sch["exclusiveMinimum"]); ok && v <= min {
+		add("must be > %s, got %s", formatNumber(min), formatNumber(v))
+	}
+	if max, ok := number(sch["exclusiveMaximum"]); ok && v >= max {
+		add("must be < %s, got %s", formatNumber(max), formatNumber(v))
+	}
+	if multiple, ok := number(sch["multipleOf"]); ok && multiple != 0 {
+		if q := v / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+			add("must be a multiple of %s, got %s", formatNumber(multiple), formatNumber(v))
+		}
+	}
+}
+
+// matches reports whether the value is valid against a sub schema
+func (s *Schema) matches(schema interface{}, value interface{}) bool {
+	var violations []Violation
+	s.validate(schema, value, nil, &violations)
+	return len(violations) == 0
+}
+
+// resolveRef resolves a local JSON pointer such as #/definitions/port, or with
+// a loader a pointer into another document such as _definitions.json#/definitions/port
+func (s *Schema) resolveRef(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		if s.loader == nil {
+			return nil, fmt.Errorf("unsupported schema reference %q, only local references are supported", ref)
+		}
+		uri, fragment, _ := strings.Cut(ref, "#")
+		doc, err := s.loader.document(uri)
+		if err != nil {
+			return nil, err
+		}
+		return resolvePointer(doc, fragment, ref)
+	}
+	return resolvePointer(s.root, strings.TrimPrefix(ref, "#"), ref)
+}
+
+// resolvePointer resolves a JSON pointer in a document
+func resolvePointer(doc interface{}, pointer, ref string) (interface{}, error) {
+	current := doc
+	if pointer == "" {
+		return current, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("schema reference %q not found", ref)
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("schema reference %q not found", ref)
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("schema reference %q not found", ref)
+		}
+	}
+	return current, nil
+}
+
+func (s *Schema) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := s.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[pattern] = re
+	return re, nil
+}
+
+func schemaTypes(t interface{}) ([]string, bool) {
+	switch v := t.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		var types []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalize converts decoded YAML into the JSON data model: numbers become
+// float64 and maps get string keys
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = normalize(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[fmt.Sprintf("%v", key)] = normalize(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := normalize(value).(type) {
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func render(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
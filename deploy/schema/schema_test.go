@@ -0,0 +1,217 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["image"],
+  "properties": {
+    "replicaCount": {"type": "integer", "minimum": 1, "maximum": 10},
+    "image": {
+      "type": "object",
+      "required": ["repository"],
+      "properties": {
+        "repository": {"type": "string", "minLength": 1},
+        "tag": {"type": ["string", "null"]},
+        "pullPolicy": {"enum": ["Always", "IfNotPresent", "Never"]}
+      }
+    },
+    "ingress": {"$ref": "#/definitions/ingress"},
+    "ports": {"type": "array", "items": {"$ref": "#/definitions/port"}, "uniqueItems": true},
+    "mode": {"oneOf": [{"const": "simple"}, {"type": "object"}]}
+  },
+  "definitions": {
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+    "ingress": {
+      "type": "object",
+      "properties": {
+        "enabled": {"type": "boolean"},
+        "host": {"type": "string", "pattern": "^[a-z0-9.-]+$"}
+      }
+    }
+  }
+}`
+
+func validate(t *testing.T, schemaContent, values string) []string {
+	t.Helper()
+	s, err := Parse([]byte(schemaContent))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(values), &doc); err != nil {
+		t.Fatalf("Failed to parse values: %v", err)
+	}
+	var result []string
+	for _, v := range s.Validate(doc) {
+		result = append(result, v.String())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   string
+		expected []string
+	}{
+		{
+			name: "valid",
+			values: `replicaCount: 3
+image:
+  repository: nginx
+  tag: null
+  pullPolicy: Always
+ingress:
+  enabled: true
+  host: app.example.com
+ports: [80, 443]
+mode: simple
+`,
+		},
+		{
+			name: "typo and wrong types",
+			values: `replicaCount: "3"
+image:
+  repository: nginx
+  pullPolicy: Sometimes
+ingres:
+  enabled: true
+`,
+			expected: []string{
+				`image.pullPolicy: must be one of ["Always","IfNotPresent","Never"], got "Sometimes"`,
+				"ingres: unknown key, additional properties are not allowed",
+				"replicaCount: expected integer, got string",
+			},
+		},
+		{
+			name: "references, arrays and ranges",
+			values: `replicaCount: 11
+image:
+  repository: ""
+ingress:
+  host: App.example.com
+ports: [80, 70000, 80]
+mode: 3
+`,
+			expected: []string{
+				"image.repository: must be at least 1 characters long",
+				`ingress.host: "App.example.com" does not match pattern "^[a-z0-9.-]+$"`,
+				"mode: does not match any of the allowed schemas",
+				"ports: items 0 and 2 are equal but must be unique",
+				"ports[1]: must be <= 65535, got 70000",
+				"replicaCount: must be <= 10, got 11",
+			},
+		},
+		{
+			name:     "missing required",
+			values:   "replicaCount: 1\n",
+			expected: []string{"image is required"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := validate(t, testSchema, tc.values)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("Expected %d violations %v, got %d: %v", len(tc.expected), tc.expected, len(got), got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("Expected violation %q, got %q", tc.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParse_YAMLSchema(t *testing.T) {
+	got := validate(t, "type: object\nproperties:\n  size:\n    type: number\n    multipleOf: 0.5\n", "size: 1.25\n")
+	if len(got) != 1 || got[0] != "size: must be a multiple of 0.5, got 1.25" {
+		t.Errorf("Unexpected violations: %v", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse([]byte(`"just a string"`)); err == nil {
+		t.Error("Expected an error for a schema that is not an object")
+	}
+}
+
+func TestLoader_ExternalReferences(t *testing.T) {
+	documents := map[string]string{
+		"schemas/v1/deployment-apps-v1.json": `{"$ref": "_definitions.json#/definitions/io.k8s.api.apps.v1.Deployment"}`,
+		"schemas/v1/_definitions.json": `{"definitions": {
+  "io.k8s.api.apps.v1.Deployment": {
+    "type": "object",
+    "additionalProperties": false,
+    "properties": {"kind": {"type": "string"}, "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}}
+  },
+  "io.k8s.api.apps.v1.DeploymentSpec": {
+    "type": "object",
+    "properties": {"replicas": {"type": "integer"}}
+  }
+}}`,
+	}
+	reads := 0
+	loader := NewLoader(func(uri string) ([]byte, error) {
+		reads++
+		content, ok := documents[uri]
+		if !ok {
+			return nil, fmt.Errorf("not found")
+		}
+		return []byte(content), nil
+	})
+
+	s, err := loader.Load("schemas/v1/deployment-apps-v1.json")
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte("kind: Deployment\nspec:\n  replicas: two\nspek: {}\n"), &doc); err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+	var got []string
+	for _, v := range s.Validate(doc) {
+		got = append(got, v.String())
+	}
+	sort.Strings(got)
+	expected := []string{"spec.replicas: expected integer, got string", "spek: unknown key, additional properties are not allowed"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected violations %v, got %v", expected, got)
+	}
+
+	// The shared definitions are read once
+	if _, err := loader.Load("schemas/v1/deployment-apps-v1.json"); err != nil || reads != 2 {
+		t.Errorf("Expected 2 reads, got %d (%v)", reads, err)
+	}
+
+	missing, err := loader.Load("schemas/v1/missing.json")
+	if err == nil || missing != nil {
+		t.Error("Expected an error for a missing schema")
+	}
+}
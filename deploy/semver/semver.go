@@ -0,0 +1,353 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LatestStable selects the highest version without a prerelease
+const LatestStable = "latest-stable"
+
+var versionRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// Version is a semantic version
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease string
+	Metadata   string
+	// Original is the string the version was parsed from
+	Original string
+}
+
+// Parse parses a semantic version; a missing minor or patch number is treated as 0
+func Parse(s string) (*Version, error) {
+	m := versionRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, fmt.Errorf("invalid semantic version %q", s)
+	}
+
+	v := &Version{Prerelease: m[4], Metadata: m[5], Original: s}
+	var err error
+	if v.Major, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid major version in %q: %v", s, err)
+	}
+	if m[2] != "" {
+		if v.Minor, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid minor version in %q: %v", s, err)
+		}
+	}
+	if m[3] != "" {
+		if v.Patch, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid patch version in %q: %v", s, err)
+		}
+	}
+	return v, nil
+}
+
+// String returns the normalized version
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Metadata != "" {
+		s += "+" + v.Metadata
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 following semver precedence; build metadata is ignored
+func (v *Version) Compare(o *Version) int {
+	for _, pair := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.ParseUint(aParts[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bParts[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aParts[i], bParts[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+	return 0
+}
+
+// comparator is a single operator/version pair such as >=1.2.0
+type comparator struct {
+	op      string
+	version *Version
+}
+
+func (c comparator) matches(v *Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Constraint is a set of alternatives (joined by ||) of comparators that must all match
+type Constraint struct {
+	alternatives [][]comparator
+	// latestStable matches every stable version, so Select picks the highest
+	latestStable bool
+	original     string
+}
+
+var comparatorRegex = regexp.MustCompile(`^(>=|<=|!=|=|>|<|~|\^)?\s*(\S+)$`)
+
+// IsConstraint reports whether the version string needs to be resolved, i.e. it
+// is not an exact version that can be passed to helm unchanged
+func IsConstraint(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+	if s == LatestStable {
+		return true
+	}
+	if strings.ContainsAny(s, "<>=~^*|, ") || strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".X") {
+		return true
+	}
+	m := versionRegex.FindStringSubmatch(s)
+	if m == nil {
+		// Not a semantic version at all, leave it to helm
+		return false
+	}
+	// Partial versions such as 1.4 are treated as 1.4.x ranges
+	return m[2] == "" || m[3] == ""
+}
+
+// ParseConstraint parses constraints such as "~1.4", ">=2.0 <3", "^1.2.3 || 2.x" or "latest-stable"
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{original: s}
+	s = strings.TrimSpace(s)
+	if s == LatestStable || s == "*" || s == "x" {
+		c.latestStable = true
+		return c, nil
+	}
+
+	for _, alternative := range strings.Split(s, "||") {
+		var comparators []comparator
+		fields := strings.FieldsFunc(alternative, func(r rune) bool { return r == ',' || r == ' ' })
+
+		// Re-attach operators separated from their version by a space ("> 1.2")
+		var tokens []string
+		for i := 0; i < len(fields); i++ {
+			if strings.Trim(fields[i], "<>=!~^") == "" && i+1 < len(fields) {
+				tokens = append(tokens, fields[i]+fields[i+1])
+				i++
+				continue
+			}
+			tokens = append(tokens, fields[i])
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("empty version constraint in %q", s)
+		}
+
+		for _, token := range tokens {
+			parsed, err := parseComparator(token)
+			if err != nil {
+				return nil, err
+			}
+			comparators = append(comparators, parsed...)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+	return c, nil
+}
+
+// parseComparator expands a single constraint token into plain comparators
+func parseComparator(token string) ([]comparator, error) {
+	m := comparatorRegex.FindStringSubmatch(token)
+	if m == nil {
+		return nil, fmt.Errorf("invalid version constraint %q", token)
+	}
+	op, raw := m[1], strings.TrimPrefix(m[2], "v")
+
+	// Split off prerelease and metadata so only the numeric core is inspected
+	core, suffix := raw, ""
+	if idx := strings.IndexAny(raw, "-+"); idx >= 0 {
+		core, suffix = raw[:idx], raw[idx:]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version constraint %q", token)
+	}
+
+	// Count the numeric parts before a wildcard such as 1.x or 1.2.*
+	specified := 0
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		specified++
+	}
+	if specified == 0 {
+		return []comparator{{">=", &Version{}}}, nil
+	}
+	if specified < len(parts) {
+		suffix = ""
+	}
+
+	v, err := Parse(strings.Join(parts[:specified], ".") + suffix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %q: %v", token, err)
+	}
+
+	switch op {
+	case "~":
+		upper := &Version{Major: v.Major, Minor: v.Minor + 1}
+		if specified == 1 {
+			upper = &Version{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "^":
+		var upper *Version
+		switch {
+		case v.Major > 0 || specified == 1:
+			upper = &Version{Major: v.Major + 1}
+		case v.Minor > 0 || specified == 2:
+			upper = &Version{Minor: v.Minor + 1}
+		default:
+			upper = &Version{Patch: v.Patch + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "", "=":
+		if specified == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		// Partial versions match the whole range: 1.4 is >=1.4.0 <1.5.0
+		upper := &Version{Major: v.Major + 1}
+		if specified == 2 {
+			upper = &Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	default:
+		return []comparator{{op, v}}, nil
+	}
+}
+
+// Check reports whether the version satisfies the constraint. Prereleases only
+// match if a comparator of the matching alternative mentions a prerelease itself.
+func (c *Constraint) Check(v *Version) bool {
+	if c.latestStable {
+		return v.Prerelease == ""
+	}
+
+	for _, alternative := range c.alternatives {
+		allowPrerelease := false
+		matched := true
+		for _, comp := range alternative {
+			if comp.version.Prerelease != "" {
+				allowPrerelease = true
+			}
+			if !comp.matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched && (v.Prerelease == "" || allowPrerelease) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as it was written
+func (c *Constraint) String() string {
+	return c.original
+}
+
+// Select returns the highest of the given versions that satisfies the constraint
+// Versions that are not valid semantic versions are skipped
+func (c *Constraint) Select(versions []string) (*Version, error) {
+	var candidates []*Version
+	for _, raw := range versions {
+		v, err := Parse(raw)
+		if err != nil {
+			continue
+		}
+		if c.Check(v) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no version matches constraint %q", c.original)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Compare(candidates[j]) > 0
+	})
+	return candidates[0], nil
+}
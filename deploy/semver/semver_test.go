@@ -0,0 +1,137 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package semver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{"1.2.3", "1.2.3", false},
+		{"v1.2.3", "1.2.3", false},
+		{"1.2", "1.2.0", false},
+		{"1.2.3-rc.1+build.5", "1.2.3-rc.1+build.5", false},
+		{"latest", "", true},
+		{"1.2.3.4", "", true},
+	}
+
+	for _, tc := range testCases {
+		v, err := Parse(tc.input)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %q, got %v", tc.input, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tc.input, err)
+			continue
+		}
+		if v.String() != tc.expected {
+			t.Errorf("Parse(%q) = %s, expected %s", tc.input, v.String(), tc.expected)
+		}
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := Parse(ordered[i])
+		b, _ := Parse(ordered[i+1])
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("Expected %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	testCases := map[string]bool{
+		"":              false,
+		"1.2.3":         false,
+		"v1.2.3-rc.1":   false,
+		"not-a-version": false,
+		"1.4":           true,
+		"1.4.x":         true,
+		"~1.4":          true,
+		"^2.0.0":        true,
+		">=2.0 <3":      true,
+		"latest-stable": true,
+	}
+
+	for input, expected := range testCases {
+		if got := IsConstraint(input); got != expected {
+			t.Errorf("IsConstraint(%q) = %v, expected %v", input, got, expected)
+		}
+	}
+}
+
+func TestConstraint_Select(t *testing.T) {
+	available := []string{"1.3.9", "1.4.0", "1.4.7", "1.5.0", "2.0.0-rc.1", "2.0.0", "2.3.1", "3.0.0", "3.1.0-beta.1", "not-semver"}
+
+	testCases := []struct {
+		constraint  string
+		expected    string
+		expectError bool
+	}{
+		{"~1.4", "1.4.7", false},
+		{"~1", "1.5.0", false},
+		{"^1.4.0", "1.5.0", false},
+		{">=2.0 <3", "2.3.1", false},
+		{">=2.0, <3", "2.3.1", false},
+		{"1.4.x", "1.4.7", false},
+		{"1.x", "1.5.0", false},
+		{"2", "2.3.1", false},
+		{"~1.3 || ~2.0", "2.0.0", false},
+		{"latest-stable", "3.0.0", false},
+		{">=3.1.0-beta.0", "3.1.0-beta.1", false},
+		{">=4", "", true},
+	}
+
+	for _, tc := range testCases {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) failed: %v", tc.constraint, err)
+			continue
+		}
+		v, err := c.Select(available)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("Expected no match for %q, got %s", tc.constraint, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Select(%q) failed: %v", tc.constraint, err)
+			continue
+		}
+		if v.Original != tc.expected {
+			t.Errorf("Select(%q) = %s, expected %s", tc.constraint, v.Original, tc.expected)
+		}
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, input := range []string{"~foo", ">=1.2.3.4", "||"} {
+		if _, err := ParseConstraint(input); err == nil {
+			t.Errorf("Expected error for constraint %q", input)
+		}
+	}
+}
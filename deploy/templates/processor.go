@@ -24,6 +24,47 @@ import (
 	"text/template"
 )
 
+// Data is the data object available to domain templates and rendered values files and manifests
+type Data struct {
+	Domains      []string
+	IngressHosts []string
+	Config       *config.Config
+	ReleaseName  string
+	Namespace    string
+	Stage        string
+	PR           string
+	GitSHA       string
+}
+
+// NewData builds the template data for a deployment
+func NewData(cfg *config.Config) Data {
+	return Data{
+		Domains:      cfg.Domains,
+		IngressHosts: cfg.IngressHosts,
+		Config:       cfg,
+		ReleaseName:  cfg.ReleaseName,
+		Namespace:    cfg.Namespace,
+		Stage:        cfg.Stage,
+		PR:           cfg.PRNumber,
+		GitSHA:       cfg.GitSHA,
+	}
+}
+
+// Render executes content as a Go template with the deployment data
+// Errors name the file and line, e.g. "template: values/live.yaml:3: ..."
+func Render(name string, content []byte, data Data) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, utils.NewError("failed to parse %s: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, utils.NewError("failed to render %s: %v", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
 // ProcessDomainTemplate creates a values file from a domain template
 func ProcessDomainTemplate(cfg *config.Config) (string, error) {
 	if len(cfg.IngressHosts) == 0 {
@@ -70,18 +111,8 @@ func ProcessDomainTemplate(cfg *config.Config) (string, error) {
 		return "", utils.NewError("failed to parse domain template: %v", err)
 	}
 
-	data := struct {
-		Domains      []string
-		IngressHosts []string
-		Config       *config.Config
-	}{
-		Domains:      cfg.Domains,
-		IngressHosts: cfg.IngressHosts,
-		Config:       cfg,
-	}
-
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
+	if err := tmpl.Execute(&buf, NewData(cfg)); err != nil {
 		return "", utils.NewError("failed to execute domain template: %v", err)
 	}
 
@@ -208,3 +208,51 @@ func TestListEmbeddedTemplates(t *testing.T) {
 		}
 	}
 }
+
+func TestRender(t *testing.T) {
+	data := NewData(&config.Config{
+		ReleaseName: "myapp-pr-42",
+		Namespace:   "myapp-dev",
+		Stage:       "dev",
+		PRNumber:    "42",
+		GitSHA:      "abc123",
+	})
+
+	content := []byte(`fullnameOverride: {{ .ReleaseName }}
+namespace: {{ .Namespace }}
+image:
+  tag: {{ .GitSHA }}
+{{- if .PR }}
+replicas: 1
+{{- end }}
+`)
+	rendered, err := Render("values/dev.yaml", content, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	for _, expected := range []string{"fullnameOverride: myapp-pr-42", "namespace: myapp-dev", "tag: abc123", "replicas: 1"} {
+		if !strings.Contains(string(rendered), expected) {
+			t.Errorf("Expected rendered content to contain %q, got:\n%s", expected, rendered)
+		}
+	}
+}
+
+func TestRender_ErrorsReportFileAndLine(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"parse error", "a: 1\nb: {{ .Stage\n", "values/live.yaml:2"},
+		{"unknown field", "a: 1\nb: 2\nc: {{ .Unknown }}\n", "values/live.yaml:3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Render("values/live.yaml", []byte(tc.content), NewData(&config.Config{}))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error mentioning %s, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around each change
+	diffContext = 3
+	// maxDiffCells bounds the LCS table; larger inputs fall back to a full replace
+	maxDiffCells = 4_000_000
+)
+
+// manifestResource is a single resource of a rendered manifest prepared for comparison
+type manifestResource struct {
+	id    string
+	text  string
+	value interface{}
+}
+
+// ShowManifestDiff compares two rendered manifests resource by resource and prints
+// a unified diff for every resource that changed. Fields matched by the ignore
+// rules are removed from both sides first, so a resource that only differs in
+// ignored fields is reported as unchanged.
+func ShowManifestDiff(current, proposed []byte, rules []DiffIgnoreRule, debug bool) error {
+	if debug {
+		Log.Debugln("Current YAML:")
+		fmt.Println(MaskSecrets(string(current)))
+
+		Log.Debugln("Proposed YAML:")
+		fmt.Println(MaskSecrets(string(proposed)))
+	}
+
+	currentResources, err := parseManifestResources(current, rules)
+	if err != nil {
+		return NewError("failed to parse current manifest: %v", err)
+	}
+	proposedResources, err := parseManifestResources(proposed, rules)
+	if err != nil {
+		return NewError("failed to parse proposed manifest: %v", err)
+	}
+
+	currentByID := make(map[string]manifestResource, len(currentResources))
+	for _, res := range currentResources {
+		currentByID[res.id] = res
+	}
+	proposedIDs := make(map[string]bool, len(proposedResources))
+
+	var unchanged []string
+	added, changed, removed := 0, 0, 0
+
+	for _, res := range proposedResources {
+		proposedIDs[res.id] = true
+		old, exists := currentByID[res.id]
+		switch {
+		case !exists:
+			added++
+			fmt.Println(ColorizeKubectlDiff(MaskSecrets(UnifiedDiff("/dev/null", "proposed/"+res.id, "", res.text))))
+		case reflect.DeepEqual(old.value, res.value):
+			unchanged = append(unchanged, res.id)
+		default:
+			changed++
+			fmt.Println(ColorizeKubectlDiff(MaskSecrets(UnifiedDiff("current/"+res.id, "proposed/"+res.id, old.text, res.text))))
+		}
+	}
+
+	for _, res := range currentResources {
+		if !proposedIDs[res.id] {
+			removed++
+			fmt.Println(ColorizeKubectlDiff(MaskSecrets(UnifiedDiff("current/"+res.id, "/dev/null", res.text, ""))))
+		}
+	}
+
+	for _, id := range unchanged {
+		Log.Debugf("Unchanged: %s", id)
+	}
+	Log.Infof("Diff summary: %d to add, %d to change, %d to remove, %d unchanged", added, changed, removed, len(unchanged))
+	return nil
+}
+
+// parseManifestResources splits a multi-document manifest into resources and
+// strips every field matched by the ignore rules
+func parseManifestResources(manifest []byte, rules []DiffIgnoreRule) ([]manifestResource, error) {
+	var resources []manifestResource
+	dec := yaml.NewDecoder(bytes.NewReader(manifest))
+
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		for _, item := range listItems(&doc) {
+			resource, ok, err := parseManifestResource(item, rules)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				resources = append(resources, resource)
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+// listItems returns the items of a List as kubectl prints several objects,
+// otherwise the document itself
+func listItems(doc *yaml.Node) []*yaml.Node {
+	root := doc.Content[0]
+	var kind string
+	var items *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "kind":
+			kind = root.Content[i+1].Value
+		case "items":
+			items = root.Content[i+1]
+		}
+	}
+	if kind != "List" || items == nil || items.Kind != yaml.SequenceNode {
+		return []*yaml.Node{doc}
+	}
+
+	var result []*yaml.Node
+	for _, item := range items.Content {
+		if item.Kind == yaml.MappingNode {
+			result = append(result, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{item}})
+		}
+	}
+	return result
+}
+
+// parseManifestResource strips the fields matched by the ignore rules from a
+// resource document. Documents without a kind are skipped.
+func parseManifestResource(doc *yaml.Node, rules []DiffIgnoreRule) (manifestResource, bool, error) {
+	var meta struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+	}
+	if err := doc.Decode(&meta); err != nil || meta.Kind == "" {
+		return manifestResource{}, false, nil
+	}
+
+	for _, rule := range rules {
+		if rule.Applies(meta.Kind) {
+			rule.Remove(doc)
+		}
+	}
+
+	id := meta.Kind + "/" + meta.Metadata.Name
+	if meta.Metadata.Namespace != "" {
+		id = meta.Kind + "/" + meta.Metadata.Namespace + "/" + meta.Metadata.Name
+	}
+
+	var value interface{}
+	if err := doc.Decode(&value); err != nil {
+		return manifestResource{}, false, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return manifestResource{}, false, err
+	}
+	enc.Close()
+
+	return manifestResource{
+		id:    id,
+		text:  buf.String(),
+		value: value,
+	}, true, nil
+}
+
+// UnifiedDiff returns a unified diff between two texts, or an empty string if they are equal
+func UnifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	a := splitLines(from)
+	b := splitLines(to)
+	ops := diffLines(a, b)
+
+	// Line numbers in a and b before each operation
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	idx := 0
+	for idx < len(ops) {
+		for idx < len(ops) && ops[idx].kind == ' ' {
+			idx++
+		}
+		if idx == len(ops) {
+			break
+		}
+
+		start := max(idx-diffContext, 0)
+		end := idx
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			run := 0
+			for end+run < len(ops) && ops[end+run].kind == ' ' {
+				run++
+			}
+			if end+run < len(ops) && run <= 2*diffContext {
+				end += run
+				continue
+			}
+			break
+		}
+		stop := min(end+diffContext, len(ops))
+
+		aCount := aLine[stop] - aLine[start]
+		bCount := bLine[stop] - bLine[start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		for _, op := range ops[start:stop] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		idx = stop
+	}
+
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines computes a minimal line edit script using a longest common subsequence table
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+
+	// Strip the common prefix and suffix to keep the table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	n, m := len(midA), len(midB)
+	if n*m > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case midA[i] == midB[j]:
+				ops = append(ops, diffOp{' ', midA[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				ops = append(ops, diffOp{'-', midA[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', midB[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			ops = append(ops, diffOp{'-', midA[i]})
+		}
+		for ; j < m; j++ {
+			ops = append(ops, diffOp{'+', midB[j]})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,217 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDiffIgnoreRules are the rules applied unless disabled with --diff-ignore-defaults=false.
+// They hide fields that change on every chart bump or run without changing the
+// workload, and the fields the API server sets on live objects.
+var DefaultDiffIgnoreRules = []string{
+	"metadata.labels['helm.sh/chart']",
+	"metadata.labels['app.kubernetes.io/managed-by']",
+	"metadata.labels.chart",
+	"metadata.labels.heritage",
+	"metadata.annotations['checksum/*']",
+	"metadata.annotations['helm-ci/deployed-at']",
+	"metadata.annotations['helm-ci/run-url']",
+	"spec.template.metadata.labels['helm.sh/chart']",
+	"spec.template.metadata.annotations['checksum/*']",
+	"metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']",
+	"metadata.managedFields",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.uid",
+	"metadata.creationTimestamp",
+	"status",
+}
+
+// DiffIgnoreRule removes a field from resources before they are compared
+type DiffIgnoreRule struct {
+	// Kind restricts the rule to one resource kind; empty or "*" matches every kind
+	Kind string
+	// Path holds the field path segments; "*" globs match any key or list index
+	Path []string
+}
+
+// ParseDiffIgnoreRule parses a rule of the form [Kind:]path where path is a
+// JSONPath-like selector such as spec.template.metadata.annotations['checksum/*']
+func ParseDiffIgnoreRule(rule string) (DiffIgnoreRule, error) {
+	rule = strings.TrimSpace(rule)
+	var result DiffIgnoreRule
+
+	if idx := strings.Index(rule, ":"); idx > 0 && !strings.ContainsAny(rule[:idx], ".['\"") {
+		result.Kind = rule[:idx]
+		rule = rule[idx+1:]
+	}
+
+	rule = strings.TrimPrefix(strings.TrimPrefix(rule, "$"), ".")
+	if rule == "" {
+		return result, fmt.Errorf("empty diff ignore path")
+	}
+
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			result.Path = append(result.Path, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(rule); i++ {
+		switch ch := rule[i]; ch {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(rule[i:], ']')
+			if end < 0 {
+				return result, fmt.Errorf("unterminated '[' in diff ignore path %q", rule)
+			}
+			inner := rule[i+1 : i+end]
+			if i+1 < len(rule) && (rule[i+1] == '\'' || rule[i+1] == '"') {
+				quote := rule[i+1]
+				closing := strings.IndexByte(rule[i+2:], quote)
+				if closing < 0 {
+					return result, fmt.Errorf("unterminated quote in diff ignore path %q", rule)
+				}
+				inner = rule[i+2 : i+2+closing]
+				end = closing + 3
+				if i+end >= len(rule) || rule[i+end] != ']' {
+					return result, fmt.Errorf("expected ']' after quoted key in diff ignore path %q", rule)
+				}
+			}
+			result.Path = append(result.Path, inner)
+			i += end
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	flush()
+
+	if len(result.Path) == 0 {
+		return result, fmt.Errorf("empty diff ignore path")
+	}
+	return result, nil
+}
+
+// ParseDiffIgnoreRules parses the user supplied rules, optionally prepending the defaults
+func ParseDiffIgnoreRules(rules []string, withDefaults bool) ([]DiffIgnoreRule, error) {
+	var all []string
+	if withDefaults {
+		all = append(all, DefaultDiffIgnoreRules...)
+	}
+	all = append(all, rules...)
+
+	parsed := make([]DiffIgnoreRule, 0, len(all))
+	for _, rule := range all {
+		r, err := ParseDiffIgnoreRule(rule)
+		if err != nil {
+			return nil, NewError("invalid diff ignore rule %q: %v", rule, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// Applies reports whether the rule is relevant for the given kind
+func (r DiffIgnoreRule) Applies(kind string) bool {
+	return r.Kind == "" || r.Kind == "*" || strings.EqualFold(r.Kind, kind)
+}
+
+// Remove deletes every field matched by the rule from the document node
+// Returns true if anything was removed
+func (r DiffIgnoreRule) Remove(node *yaml.Node) bool {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return false
+		}
+		node = node.Content[0]
+	}
+	return removeFieldPath(node, r.Path)
+}
+
+func removeFieldPath(node *yaml.Node, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	removed := false
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); {
+			if !matchPathSegment(path[0], node.Content[i].Value) {
+				i += 2
+				continue
+			}
+			if len(path) == 1 {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				removed = true
+				continue
+			}
+			if removeFieldPath(node.Content[i+1], path[1:]) {
+				removed = true
+				// Drop maps emptied by the rule, so a resource with only ignored
+				// annotations matches one without annotations
+				if child := node.Content[i+1]; child.Kind == yaml.MappingNode && len(child.Content) == 0 {
+					node.Content = append(node.Content[:i], node.Content[i+2:]...)
+					continue
+				}
+			}
+			i += 2
+		}
+	case yaml.SequenceNode:
+		for i := 0; i < len(node.Content); {
+			if !matchPathSegment(path[0], strconv.Itoa(i)) {
+				i++
+				continue
+			}
+			if len(path) == 1 {
+				node.Content = append(node.Content[:i], node.Content[i+1:]...)
+				removed = true
+				// Indices shift after removal, so only wildcard segments keep matching
+				if !strings.Contains(path[0], "*") {
+					break
+				}
+				continue
+			}
+			if removeFieldPath(node.Content[i], path[1:]) {
+				removed = true
+			}
+			i++
+		}
+	}
+	return removed
+}
+
+// matchPathSegment matches a key against a path segment where '*' matches any characters
+func matchPathSegment(pattern, key string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == key
+	}
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, err := regexp.MatchString(expr, key)
+	return err == nil && matched
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiffIgnoreRule(t *testing.T) {
+	testCases := []struct {
+		name         string
+		rule         string
+		expectedKind string
+		expectedPath []string
+		expectError  bool
+	}{
+		{
+			name:         "simple path",
+			rule:         "status",
+			expectedPath: []string{"status"},
+		},
+		{
+			name:         "kind prefix",
+			rule:         "Deployment:spec.replicas",
+			expectedKind: "Deployment",
+			expectedPath: []string{"spec", "replicas"},
+		},
+		{
+			name:         "quoted key with dots and slashes",
+			rule:         "metadata.labels['helm.sh/chart']",
+			expectedPath: []string{"metadata", "labels", "helm.sh/chart"},
+		},
+		{
+			name:         "quoted key with colon is not a kind",
+			rule:         `metadata.annotations["example.com/a:b"]`,
+			expectedPath: []string{"metadata", "annotations", "example.com/a:b"},
+		},
+		{
+			name:         "list index and wildcard",
+			rule:         "$.spec.template.spec.containers[*].env[0]",
+			expectedPath: []string{"spec", "template", "spec", "containers", "*", "env", "0"},
+		},
+		{
+			name:        "unterminated bracket",
+			rule:        "metadata.labels['helm.sh/chart'",
+			expectError: true,
+		},
+		{
+			name:        "empty path",
+			rule:        "Deployment:",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseDiffIgnoreRule(tc.rule)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected error for rule %q, got %+v", tc.rule, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule.Kind != tc.expectedKind {
+				t.Errorf("Expected kind %q, got %q", tc.expectedKind, rule.Kind)
+			}
+			if !reflect.DeepEqual(rule.Path, tc.expectedPath) {
+				t.Errorf("Expected path %v, got %v", tc.expectedPath, rule.Path)
+			}
+		})
+	}
+}
+
+func TestParseDiffIgnoreRules_Defaults(t *testing.T) {
+	rules, err := ParseDiffIgnoreRules([]string{"Deployment:spec.replicas"}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != len(DefaultDiffIgnoreRules)+1 {
+		t.Errorf("Expected %d rules, got %d", len(DefaultDiffIgnoreRules)+1, len(rules))
+	}
+
+	rules, err = ParseDiffIgnoreRules(nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("Expected no rules without defaults, got %d", len(rules))
+	}
+}
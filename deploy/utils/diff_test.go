@@ -0,0 +1,193 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+const currentDeployment = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    helm.sh/chart: app-1.0.0
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        checksum/config: aaaa
+`
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+func TestShowManifestDiff_IgnoredFieldsOnly(t *testing.T) {
+	proposed := strings.NewReplacer("app-1.0.0", "app-1.1.0", "aaaa", "bbbb").Replace(currentDeployment)
+
+	rules, err := ParseDiffIgnoreRules(nil, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var logBuf bytes.Buffer
+	origLogOut := Log.Out
+	Log.Out = &logBuf
+	defer func() { Log.Out = origLogOut }()
+
+	output := captureStdout(t, func() {
+		if err := ShowManifestDiff([]byte(currentDeployment), []byte(proposed), rules, false); err != nil {
+			t.Errorf("ShowManifestDiff returned error: %v", err)
+		}
+	})
+
+	if strings.Contains(output, "@@") {
+		t.Errorf("Expected no diff hunks when only ignored fields change, got:\n%s", output)
+	}
+	if !strings.Contains(logBuf.String(), "0 to change") || !strings.Contains(logBuf.String(), "1 unchanged") {
+		t.Errorf("Expected resource to be reported as unchanged, got: %s", logBuf.String())
+	}
+}
+
+func TestShowManifestDiff_RealChange(t *testing.T) {
+	proposed := strings.NewReplacer("app-1.0.0", "app-1.1.0", "replicas: 2", "replicas: 3").Replace(currentDeployment)
+
+	rules, err := ParseDiffIgnoreRules(nil, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var logBuf bytes.Buffer
+	origLogOut := Log.Out
+	Log.Out = &logBuf
+	defer func() { Log.Out = origLogOut }()
+
+	output := captureStdout(t, func() {
+		if err := ShowManifestDiff([]byte(currentDeployment), []byte(proposed), rules, false); err != nil {
+			t.Errorf("ShowManifestDiff returned error: %v", err)
+		}
+	})
+
+	if !strings.Contains(output, redColor+"-  replicas: 2"+resetColor) || !strings.Contains(output, greenColor+"+  replicas: 3"+resetColor) {
+		t.Errorf("Expected replicas change in diff, got:\n%s", output)
+	}
+	if strings.Contains(output, "helm.sh/chart") {
+		t.Errorf("Ignored label should not appear in the diff, got:\n%s", output)
+	}
+	if !strings.Contains(logBuf.String(), "1 to change") {
+		t.Errorf("Expected one changed resource, got: %s", logBuf.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+
+	expected := `--- old
++++ new
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k`
+
+	if got := UnifiedDiff("old", "new", from, to); got != expected {
+		t.Errorf("Unexpected diff.\nGot:\n%s\n\nExpected:\n%s", got, expected)
+	}
+
+	if got := UnifiedDiff("old", "new", from, from); got != "" {
+		t.Errorf("Expected empty diff for equal input, got:\n%s", got)
+	}
+}
+
+func TestShowManifestDiff_LiveList(t *testing.T) {
+	// kubectl get -o yaml returns a List with the fields the API server sets
+	live := `apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: web
+    uid: 0d7f9a3c
+    resourceVersion: "4711"
+    generation: 3
+    creationTimestamp: "2025-01-01T00:00:00Z"
+    managedFields:
+    - manager: kubectl
+    annotations:
+      kubectl.kubernetes.io/last-applied-configuration: '{}'
+  spec:
+    replicas: 2
+  status:
+    readyReplicas: 2
+`
+	proposed := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`
+
+	rules, err := ParseDiffIgnoreRules(nil, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var logBuf bytes.Buffer
+	origLogOut := Log.Out
+	Log.Out = &logBuf
+	defer func() { Log.Out = origLogOut }()
+
+	output := captureStdout(t, func() {
+		if err := ShowManifestDiff([]byte(live), []byte(proposed), rules, false); err != nil {
+			t.Errorf("ShowManifestDiff returned error: %v", err)
+		}
+	})
+
+	if strings.Contains(output, "@@") {
+		t.Errorf("Expected no diff hunks for server-set fields, got:\n%s", output)
+	}
+	if !strings.Contains(logBuf.String(), "0 to add, 0 to change, 0 to remove, 1 unchanged") {
+		t.Errorf("Expected the list item to match the proposed resource, got: %s", logBuf.String())
+	}
+}
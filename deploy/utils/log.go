@@ -47,6 +47,9 @@ func init() {
 
 	// Default to Info level
 	Log.SetLevel(logrus.InfoLevel)
+
+	// Never print values resolved from Vault
+	Log.AddHook(secretMaskHook{})
 }
 
 // InitLogger should be called from main after config is loaded
@@ -120,10 +123,10 @@ func ShowResourceDiff(current, proposed []byte, debug bool) error {
 
 	if debug {
 		Log.Debugln("Current YAML:")
-		fmt.Println(string(current))
+		fmt.Println(MaskSecrets(string(current)))
 
 		Log.Debugln("Proposed YAML:")
-		fmt.Println(string(proposed))
+		fmt.Println(MaskSecrets(string(proposed)))
 	}
 
 	// Use the mockable execCommand instead of exec.Command directly
@@ -131,7 +134,7 @@ func ShowResourceDiff(current, proposed []byte, debug bool) error {
 	output, err := diffCmd.CombinedOutput()
 
 	if len(output) > 0 {
-		fmt.Println(ColorizeKubectlDiff(string(output)))
+		fmt.Println(ColorizeKubectlDiff(MaskSecrets(string(output))))
 	}
 
 	if err != nil {
@@ -0,0 +1,98 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SecretMask replaces secret values in output
+const SecretMask = "******"
+
+// minSecretLength avoids masking short values such as "1" or "on" everywhere
+const minSecretLength = 4
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = map[string]bool{}
+)
+
+// RegisterSecret marks a value as secret so it is masked in logs and diffs
+// The base64 encoding and every line of multi-line values are registered as well,
+// as that is how they show up in Secret manifests and diffs
+func RegisterSecret(value string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	addSecret(value)
+	addSecret(base64.StdEncoding.EncodeToString([]byte(value)))
+	if strings.Contains(value, "\n") {
+		for _, line := range strings.Split(value, "\n") {
+			addSecret(strings.TrimSpace(line))
+		}
+	}
+}
+
+func addSecret(value string) {
+	if len(value) >= minSecretLength {
+		secrets[value] = true
+	}
+}
+
+// MaskSecrets replaces every registered secret in s
+func MaskSecrets(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	if len(secrets) == 0 {
+		return s
+	}
+
+	// Replace longer secrets first so a secret containing another is fully masked
+	values := make([]string, 0, len(secrets))
+	for value := range secrets {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, value := range values {
+		s = strings.ReplaceAll(s, value, SecretMask)
+	}
+	return s
+}
+
+// resetSecrets forgets all registered secrets
+func resetSecrets() {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = map[string]bool{}
+}
+
+// secretMaskHook masks registered secrets in every log message
+type secretMaskHook struct{}
+
+func (secretMaskHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (secretMaskHook) Fire(entry *logrus.Entry) error {
+	entry.Message = MaskSecrets(entry.Message)
+	return nil
+}
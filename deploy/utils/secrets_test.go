@@ -0,0 +1,64 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	RegisterSecret("hunter22")
+	RegisterSecret("line-one\nline-two")
+	RegisterSecret("on")
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"password: hunter22", "password: " + SecretMask},
+		{"data: " + base64.StdEncoding.EncodeToString([]byte("hunter22")), "data: " + SecretMask},
+		{"cert: |\n  line-one\n  line-two", "cert: |\n  " + SecretMask + "\n  " + SecretMask},
+		{"enabled: on", "enabled: on"},
+	}
+
+	for _, tc := range testCases {
+		if got := MaskSecrets(tc.input); got != tc.expected {
+			t.Errorf("MaskSecrets(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestLogMasksSecrets(t *testing.T) {
+	resetSecrets()
+	defer resetSecrets()
+
+	var buf bytes.Buffer
+	orig := Log.Out
+	Log.SetOutput(&buf)
+	defer Log.SetOutput(orig)
+
+	RegisterSecret("top-secret-value")
+	Log.Infof("resolved %s", "top-secret-value")
+
+	if strings.Contains(buf.String(), "top-secret-value") {
+		t.Errorf("Expected the secret to be masked in logs, got %q", buf.String())
+	}
+}
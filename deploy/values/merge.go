@@ -0,0 +1,332 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package values merges layered Helm values files and tracks which file set each key
+package values
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Layer is one values file in the layering chain
+type Layer struct {
+	// Name identifies the layer in provenance reports, usually its file path
+	Name    string
+	Content []byte
+}
+
+// Source is the file and line that supplied a value
+type Source struct {
+	File string
+	Line int
+}
+
+func (s Source) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// Leaf is a final value together with its source
+// Maps are merged, so only scalars, lists and empty maps are leaves
+type Leaf struct {
+	Path   string
+	Value  interface{}
+	Source Source
+}
+
+// Merged holds the result of merging layers
+type Merged struct {
+	values  map[string]interface{}
+	sources map[string]Source
+	// maps records where map keys were last written
+	maps map[string]Source
+}
+
+// Merge deep-merges the layers in order with Helm semantics: maps are merged
+// key by key, while lists and scalars of later layers replace earlier ones.
+// An explicit null replaces the earlier value and is kept in the result.
+func Merge(layers []Layer) (*Merged, error) {
+	m := &Merged{
+		values:  map[string]interface{}{},
+		sources: map[string]Source{},
+		maps:    map[string]Source{},
+	}
+
+	for _, layer := range layers {
+		dec := yaml.NewDecoder(bytes.NewReader(layer.Content))
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse %s: %v", layer.Name, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		resolveScalars(&doc)
+		root := resolveAlias(doc.Content[0])
+		if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+			continue
+		}
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: values must be a map", layer.Name, root.Line)
+		}
+		if err := m.mergeMapping(m.values, root, nil, layer.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Merged) mergeMapping(dst map[string]interface{}, node *yaml.Node, path []string, file string) error {
+	// YAML merge keys are expanded by the decoder, so handle them as nested
+	// mappings, before the explicit keys that take precedence wherever they are
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if isMergeKey(node.Content[i]) {
+			if err := m.mergeMergeKey(dst, resolveAlias(node.Content[i+1]), path, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		valueNode := resolveAlias(node.Content[i+1])
+		if isMergeKey(keyNode) {
+			continue
+		}
+
+		key := keyNode.Value
+		keyPath := append(append([]string{}, path...), key)
+		formatted := FormatPath(keyPath)
+
+		if valueNode.Kind == yaml.MappingNode {
+			existing, isMap := dst[key].(map[string]interface{})
+			if !isMap {
+				m.clearSources(formatted)
+				existing = map[string]interface{}{}
+				dst[key] = existing
+			}
+			if len(valueNode.Content) == 0 && len(existing) == 0 {
+				m.sources[formatted] = Source{File: file, Line: keyNode.Line}
+				continue
+			}
+			delete(m.sources, formatted)
+			m.maps[formatted] = Source{File: file, Line: keyNode.Line}
+			if err := m.mergeMapping(existing, valueNode, keyPath, file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value interface{}
+		if err := valueNode.Decode(&value); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, valueNode.Line, err)
+		}
+		m.clearSources(formatted)
+		dst[key] = value
+		m.sources[formatted] = Source{File: file, Line: keyNode.Line}
+	}
+	return nil
+}
+
+func (m *Merged) mergeMergeKey(dst map[string]interface{}, node *yaml.Node, path []string, file string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return m.mergeMapping(dst, node, path, file)
+	case yaml.SequenceNode:
+		// Earlier mappings in the list take precedence, so merge them last
+		for i := len(node.Content) - 1; i >= 0; i-- {
+			if err := m.mergeMergeKey(dst, resolveAlias(node.Content[i]), path, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isMergeKey(node *yaml.Node) bool {
+	return node.Value == "<<" && node.Tag == "!!merge"
+}
+
+// yaml11Bools are the plain scalars that helm reads as booleans, as it parses
+// values as YAML 1.1 while yaml.v3 only knows true and false
+var yaml11Bools = map[string]string{
+	"y": "true", "Y": "true", "yes": "true", "Yes": "true", "YES": "true",
+	"on": "true", "On": "true", "ON": "true",
+	"n": "false", "N": "false", "no": "false", "No": "false", "NO": "false",
+	"off": "false", "Off": "false", "OFF": "false",
+}
+
+// resolveScalars retags plain scalars below node the way helm reads them: the
+// YAML 1.1 boolean values are booleans and timestamps stay strings, as yaml.v3
+// would decode them to time.Time. Quoted and tagged scalars and map keys are
+// left alone.
+func resolveScalars(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		if node.Style != 0 {
+			return
+		}
+		if value, ok := yaml11Bools[node.Value]; ok && node.Tag == "!!str" {
+			node.Tag = "!!bool"
+			node.Value = value
+		}
+		if node.Tag == "!!timestamp" {
+			node.Tag = "!!str"
+		}
+		return
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		resolveScalars(child)
+	}
+}
+
+// clearSources forgets the sources recorded at or below a path
+func (m *Merged) clearSources(path string) {
+	for _, sources := range []map[string]Source{m.sources, m.maps} {
+		for p := range sources {
+			if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+				delete(sources, p)
+			}
+		}
+	}
+}
+
+// Values returns the merged values
+func (m *Merged) Values() map[string]interface{} {
+	return m.values
+}
+
+// Marshal encodes the merged values as YAML
+func (m *Merged) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(m.values); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Source returns the source of the value at a path as formatted by FormatPath
+func (m *Merged) Source(path string) (Source, bool) {
+	source, ok := m.sources[path]
+	return source, ok
+}
+
+// Locate finds the source responsible for the value at a path: the value or map
+// itself, otherwise the first value below it, otherwise the closest value above
+// it such as the list containing an indexed item
+func (m *Merged) Locate(keys []string) (Source, bool) {
+	if len(keys) == 0 {
+		return Source{}, false
+	}
+	path := FormatPath(keys)
+	if source, ok := m.sources[path]; ok {
+		return source, true
+	}
+	if source, ok := m.maps[path]; ok {
+		return source, true
+	}
+
+	var below []string
+	for p := range m.sources {
+		if strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			below = append(below, p)
+		}
+	}
+	if len(below) > 0 {
+		sort.Strings(below)
+		return m.sources[below[0]], true
+	}
+
+	for i := len(keys) - 1; i > 0; i-- {
+		if source, ok := m.sources[FormatPath(keys[:i])]; ok {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// Leaves returns every leaf value sorted by path
+func (m *Merged) Leaves() []Leaf {
+	var leaves []Leaf
+	collectLeaves(m.values, nil, func(path []string, value interface{}) {
+		formatted := FormatPath(path)
+		leaves = append(leaves, Leaf{Path: formatted, Value: value, Source: m.sources[formatted]})
+	})
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Path < leaves[j].Path })
+	return leaves
+}
+
+func collectLeaves(values map[string]interface{}, path []string, fn func([]string, interface{})) {
+	for key, value := range values {
+		keyPath := append(append([]string{}, path...), key)
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			collectLeaves(nested, keyPath, fn)
+			continue
+		}
+		fn(keyPath, value)
+	}
+}
+
+var (
+	plainKey  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	listIndex = regexp.MustCompile(`^\[[0-9]+\]$`)
+)
+
+// FormatPath joins keys to a path like ingress.annotations['kubernetes.io/tls-acme']
+// Keys of the form [n] are list indices
+func FormatPath(keys []string) string {
+	var b strings.Builder
+	for i, key := range keys {
+		switch {
+		case listIndex.MatchString(key):
+			b.WriteString(key)
+		case plainKey.MatchString(key):
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(key)
+		default:
+			b.WriteString("['")
+			b.WriteString(key)
+			b.WriteString("']")
+		}
+	}
+	return b.String()
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
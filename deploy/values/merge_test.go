@@ -0,0 +1,245 @@
+// Copyright 2025 Josef Hofer (JHOFER-Cloud)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package values
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMerge_HelmSemantics(t *testing.T) {
+	common := `image:
+  repository: nginx
+  tag: "1.25"
+ports:
+  - 80
+  - 443
+resources:
+  limits:
+    cpu: 500m
+annotations:
+  keep: "yes"
+`
+	stage := `image:
+  tag: "1.27"
+ports:
+  - 8080
+resources: null
+annotations:
+  kubernetes.io/tls-acme: "true"
+`
+
+	merged, err := Merge([]Layer{
+		{Name: "common.yaml", Content: []byte(common)},
+		{Name: "live.yaml", Content: []byte(stage)},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var expected map[string]interface{}
+	yaml.Unmarshal([]byte(`image:
+  repository: nginx
+  tag: "1.27"
+ports:
+  - 8080
+resources: null
+annotations:
+  keep: "yes"
+  kubernetes.io/tls-acme: "true"
+`), &expected)
+
+	if !reflect.DeepEqual(merged.Values(), expected) {
+		t.Errorf("Expected %v, got %v", expected, merged.Values())
+	}
+
+	expectedSources := map[string]string{
+		"image.repository":                      "common.yaml:2",
+		"image.tag":                             "live.yaml:2",
+		"ports":                                 "live.yaml:3",
+		"resources":                             "live.yaml:5",
+		"annotations.keep":                      "common.yaml:11",
+		"annotations['kubernetes.io/tls-acme']": "live.yaml:7",
+	}
+	leaves := merged.Leaves()
+	if len(leaves) != len(expectedSources) {
+		t.Errorf("Expected %d leaves, got %d: %+v", len(expectedSources), len(leaves), leaves)
+	}
+	for _, leaf := range leaves {
+		if got := leaf.Source.String(); got != expectedSources[leaf.Path] {
+			t.Errorf("Expected %s to come from %s, got %s", leaf.Path, expectedSources[leaf.Path], got)
+		}
+	}
+}
+
+func TestMerge_MapReplacesScalar(t *testing.T) {
+	merged, err := Merge([]Layer{
+		{Name: "a.yaml", Content: []byte("persistence: false\n")},
+		{Name: "b.yaml", Content: []byte("persistence:\n  enabled: true\n  size: 1Gi\n")},
+		{Name: "c.yaml", Content: []byte("persistence:\n  size: 5Gi\n")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := merged.Source("persistence"); ok {
+		t.Error("Expected the replaced scalar to have no source")
+	}
+	if source, _ := merged.Source("persistence.enabled"); source.String() != "b.yaml:2" {
+		t.Errorf("Expected persistence.enabled from b.yaml:2, got %s", source)
+	}
+	if source, _ := merged.Source("persistence.size"); source.String() != "c.yaml:2" {
+		t.Errorf("Expected persistence.size from c.yaml:2, got %s", source)
+	}
+}
+
+func TestMerge_YAML11Bools(t *testing.T) {
+	merged, err := Merge([]Layer{
+		{Name: "common.yaml", Content: []byte("ingress:\n  enabled: yes\n  tls: off\nanswer: \"yes\"\nflags: [on, \"no\", !!str y]\n")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"ingress": map[string]interface{}{"enabled": true, "tls": false},
+		"answer":  "yes",
+		"flags":   []interface{}{true, "no", "y"},
+	}
+	if !reflect.DeepEqual(merged.Values(), expected) {
+		t.Errorf("Expected %v, got %v", expected, merged.Values())
+	}
+
+	content, err := merged.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{"enabled: true", "tls: false", "answer: \"yes\""} {
+		if !strings.Contains(string(content), line) {
+			t.Errorf("Expected %q in marshalled values:\n%s", line, content)
+		}
+	}
+}
+
+func TestMerge_TimestampsStayStrings(t *testing.T) {
+	merged, err := Merge([]Layer{
+		{Name: "common.yaml", Content: []byte("date: 2001-12-14\nstamp: 2001-12-14T21:59:43Z\n")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	values := merged.Values()
+	if values["date"] != "2001-12-14" || values["stamp"] != "2001-12-14T21:59:43Z" {
+		t.Errorf("Expected the timestamps as written, got %v", values)
+	}
+	content, err := merged.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(content), `date: "2001-12-14"`) {
+		t.Errorf("Expected the date as a string in the marshalled values:\n%s", content)
+	}
+}
+
+func TestMerge_ExplicitKeysOverrideMergeKeys(t *testing.T) {
+	merged, err := Merge([]Layer{
+		{Name: "common.yaml", Content: []byte(`defaults: &defaults
+  replicas: 1
+  tier: web
+overrides: &overrides
+  tier: api
+app:
+  replicas: 3
+  <<: [*overrides, *defaults]
+`)},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	app := merged.Values()["app"]
+	expected := map[string]interface{}{"replicas": 3, "tier": "api"}
+	if !reflect.DeepEqual(app, expected) {
+		t.Errorf("Expected %v, got %v", expected, app)
+	}
+	if source, _ := merged.Source("app.replicas"); source.String() != "common.yaml:7" {
+		t.Errorf("Expected app.replicas from common.yaml:7, got %s", source)
+	}
+}
+
+func TestMerge_Errors(t *testing.T) {
+	_, err := Merge([]Layer{{Name: "list.yaml", Content: []byte("- a\n- b\n")}})
+	if err == nil || !strings.Contains(err.Error(), "list.yaml:1: values must be a map") {
+		t.Errorf("Expected map error, got %v", err)
+	}
+
+	_, err = Merge([]Layer{{Name: "broken.yaml", Content: []byte("a: [\n")}})
+	if err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+		t.Errorf("Expected parse error naming the file, got %v", err)
+	}
+
+	merged, err := Merge([]Layer{{Name: "empty.yaml", Content: []byte("# nothing\n")}})
+	if err != nil || len(merged.Values()) != 0 {
+		t.Errorf("Expected empty values for an empty file, got %v, %v", merged, err)
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	testCases := []struct {
+		keys     []string
+		expected string
+	}{
+		{[]string{"image", "tag"}, "image.tag"},
+		{[]string{"podAnnotations", "prometheus.io/scrape"}, "podAnnotations['prometheus.io/scrape']"},
+		{[]string{"a b"}, "['a b']"},
+		{[]string{"ports", "[0]", "name"}, "ports[0].name"},
+	}
+	for _, tc := range testCases {
+		if got := FormatPath(tc.keys); got != tc.expected {
+			t.Errorf("FormatPath(%v) = %s, expected %s", tc.keys, got, tc.expected)
+		}
+	}
+}
+
+func TestMerged_Locate(t *testing.T) {
+	merged, err := Merge([]Layer{
+		{Name: "common.yaml", Content: []byte("ports:\n  - 80\ningres:\n  enabled: true\n")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		keys     []string
+		expected string
+	}{
+		{[]string{"ports"}, "common.yaml:1"},
+		{[]string{"ports", "[0]"}, "common.yaml:1"},
+		{[]string{"ingres"}, "common.yaml:3"},
+	}
+	for _, tc := range testCases {
+		source, ok := merged.Locate(tc.keys)
+		if !ok || source.String() != tc.expected {
+			t.Errorf("Locate(%v) = %s, %v, expected %s", tc.keys, source, ok, tc.expected)
+		}
+	}
+	if _, ok := merged.Locate([]string{"missing"}); ok {
+		t.Error("Expected no source for a missing key")
+	}
+}
@@ -102,6 +102,7 @@ func (c *Client) GetSecret(placeholder string) (string, error) {
 		if !ok {
 			return "", utils.NewError("key %s not found in secret", vPath.Key)
 		}
+		utils.RegisterSecret(value)
 		return value, nil
 	} else {
 		var result struct {
@@ -114,6 +115,7 @@ func (c *Client) GetSecret(placeholder string) (string, error) {
 		if !ok {
 			return "", utils.NewError("key %s not found in secret", vPath.Key)
 		}
+		utils.RegisterSecret(value)
 		return value, nil
 	}
 }
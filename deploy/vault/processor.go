@@ -15,15 +15,21 @@
 package vault
 
 import (
+	"helm-ci/deploy/manifest"
 	"helm-ci/deploy/utils"
 	"regexp"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 var vaultPlaceholderRegex = regexp.MustCompile(`<<vault\.[^>]+>>`)
 
+var secretKind = regexp.MustCompile(`(?m)^kind:\s*Secret\s*$`)
+
+// HasPlaceholder reports whether the input contains at least one vault placeholder
+func HasPlaceholder(input string) bool {
+	return vaultPlaceholderRegex.MatchString(input)
+}
+
 func (c *Client) ProcessString(input string) (string, error) {
 	// First process vault placeholders
 	result := input
@@ -59,28 +65,12 @@ func (c *Client) ProcessString(input string) (string, error) {
 		}
 	}
 
-	// Then handle Kubernetes Secret base64 encoding if needed
-	if strings.Contains(result, "kind: Secret") {
-		var secret map[string]interface{}
-		if err := yaml.Unmarshal([]byte(result), &secret); err != nil {
-			return "", utils.NewError("failed to parse Secret YAML: %v", err)
-		}
-
-		// Get the data section and ensure it's a map
-		if data, ok := secret["data"].(map[string]interface{}); ok {
-			newData := make(map[string]interface{})
-			for k, v := range data {
-				newData[k] = v
-			}
-			secret["data"] = newData
-		}
-
-		// Convert back to YAML
-		yamlBytes, err := yaml.Marshal(secret)
-		if err != nil {
-			return "", utils.NewError("failed to marshal Secret YAML: %v", err)
+	// Then make sure every Kubernetes Secret is still valid YAML, as multi-line
+	// values are inserted as block scalars
+	for _, doc := range manifest.Read([]byte(result)) {
+		if doc.Err != nil && secretKind.Match(doc.Raw()) {
+			return "", utils.NewError("failed to parse Secret YAML: %v", doc.Err)
 		}
-		result = string(yamlBytes)
 	}
 
 	return result, nil
@@ -20,8 +20,12 @@ mkdir -p coverage
 packages=(
   "./deploy/config"
   "./deploy/deployment"
+  "./deploy/values"
   "./deploy/vault"
   "./deploy/utils"
+  "./deploy/semver"
+  "./deploy/schema"
+  "./deploy/manifest"
 )
 
 total_coverage=0